@@ -1,12 +1,23 @@
 package ast
 
-import "interpreter/token"
+import (
+	"bytes"
+	"fmt"
+	"interpreter/token"
+	"strings"
+)
 
 // Node is the base interface that all nodes in our AST (Abstract Syntax Tree) must implement.
 // It requires a TokenLiteral() method that returns the literal value of the token associated with the node.
-// This method is primarily used for debugging and testing purposes.
+// String() renders the node back as source-like text, which is what the parser tests compare against.
+// Both methods are primarily used for debugging and testing purposes.
+// Pos() and End() give the span of source code the node was parsed from: Pos is the position of
+// its first character and End the position immediately after its last one.
 type Node interface {
 	TokenLiteral() string
+	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 // Statement is an interface that extends the Node interface.
@@ -27,8 +38,12 @@ type Expression interface {
 	expressionNode()
 }
 
+// Program is the root node of every AST the parser produces.
+// Comments holds every comment of the source file in order, since the statements alone
+// don't keep the comments that sit between tokens the tree has no place for.
 type Program struct {
 	Statements []Statement
+	Comments   []token.Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -39,6 +54,33 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+// Pos returns the start of the first statement, or the zero Position for an empty program.
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End returns the end of the last statement, or the zero Position for an empty program.
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
+// String builds the program's text by writing out the String() of every statement in order.
+func (p *Program) String() string {
+	var out bytes.Buffer
+
+	for _, s := range p.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
 // LetStatement represents a 'let' statement in our AST (Abstract Syntax Tree).
 // It has two fields:
 // - Name: This holds the identifier (or name) of the variable being declared.
@@ -57,6 +99,38 @@ func (ls *LetStatement) statementNode() {}
 // TokenLiteral returns the literal value of the 'let' token, which is used mainly for debugging.
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// Pos returns the position of the 'let' keyword.
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+
+// End returns the end of the value, or of the name if the value is missing.
+// The optional trailing semicolon is not part of the span.
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
+
+// String renders the statement as "let <name> = <value>;".
+func (ls *LetStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ls.TokenLiteral() + " ")
+	out.WriteString(ls.Name.String())
+	out.WriteString(" = ")
+
+	// The value can be nil when the parser gave up on the expression.
+	if ls.Value != nil {
+		out.WriteString(ls.Value.String())
+	}
+
+	out.WriteString(";")
+	return out.String()
+}
+
 // Identifier represents an identifier (variable name) in our AST.
 // It implements the Expression interface, allowing it to be used in different parts of the program,
 // even though in the context of a 'let' statement, it doesn't produce a value.
@@ -72,6 +146,15 @@ func (i *Identifier) expressionNode() {}
 // TokenLiteral returns the literal value of the identifier's token, which is used mainly for debugging.
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
+// Pos returns the start of the identifier.
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+
+// End returns the end of the identifier.
+func (i *Identifier) End() token.Position { return i.Token.End }
+
+// String returns the name of the identifier.
+func (i *Identifier) String() string { return i.Value }
+
 // ReturnStatement represents a 'return' statement in the AST (Abstract Syntax Tree).
 // It contains the 'return' token and the expression to be returned.
 type ReturnStatement struct {
@@ -88,3 +171,633 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+
+// Pos returns the position of the 'return' keyword.
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+
+// End returns the end of the returned expression, or of the keyword if it's missing.
+// The optional trailing semicolon is not part of the span.
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
+// String renders the statement as "return <value>;".
+func (rs *ReturnStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(rs.TokenLiteral() + " ")
+
+	if rs.ReturnValue != nil {
+		out.WriteString(rs.ReturnValue.String())
+	}
+
+	out.WriteString(";")
+	return out.String()
+}
+
+// IntegerLiteral represents an integer such as '5' in the AST.
+// The lexer hands us the digits as a string, the parser converts them into an int64 and stores it in Value.
+type IntegerLiteral struct {
+	Token token.Token // The token.INT token.
+	Value int64       // The numeric value of the literal.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (il *IntegerLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the integer's token.
+func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+
+// Pos returns the start of the literal.
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+
+// End returns the end of the literal.
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+// String returns the integer exactly as it was written in the source.
+func (il *IntegerLiteral) String() string { return il.Token.Literal }
+
+// PrefixExpression represents an expression of the form <operator><expression>, e.g. '-5' or '!ok'.
+type PrefixExpression struct {
+	Token    token.Token // The prefix token, e.g. '!' or '-'.
+	Operator string      // The operator as a string, e.g. "!" or "-".
+	Right    Expression  // The expression the operator is applied to.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (pe *PrefixExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the operator token.
+func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+
+// Pos returns the position of the operator.
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+
+// End returns the end of the operand, or of the operator if the operand is missing.
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
+
+// String wraps the expression in parentheses so the way it was grouped by the parser is visible.
+func (pe *PrefixExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Operator)
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// InfixExpression represents an expression of the form <expression> <operator> <expression>, e.g. '5 + 5'.
+type InfixExpression struct {
+	Token    token.Token // The operator token, e.g. '+'.
+	Left     Expression  // The expression on the left side of the operator.
+	Operator string      // The operator as a string, e.g. "+".
+	Right    Expression  // The expression on the right side of the operator.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (ie *InfixExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the operator token.
+func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+
+// Pos returns the start of the left operand.
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+// End returns the end of the right operand, or of the operator if the operand is missing.
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
+
+// String wraps the expression in parentheses so the way it was grouped by the parser is visible.
+func (ie *InfixExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString(" " + ie.Operator + " ")
+	out.WriteString(ie.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ExpressionStatement is a statement that consists solely of one expression, e.g. 'x + 10;' or 'add(1, 2);'.
+// It lets us put expressions wherever a statement is expected, which is how most Monkey code is written.
+type ExpressionStatement struct {
+	Token      token.Token // The first token of the expression.
+	Expression Expression  // The expression that makes up the statement.
+}
+
+// statementNode is a dummy method that helps the Go compiler recognize this as a Statement node.
+func (es *ExpressionStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the first token of the expression.
+func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+
+// Pos returns the start of the expression.
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+	return es.Token.Pos
+}
+
+// End returns the end of the expression. The optional trailing semicolon is not part of the span.
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
+// String renders the wrapped expression.
+func (es *ExpressionStatement) String() string {
+	if es.Expression != nil {
+		return es.Expression.String()
+	}
+	return ""
+}
+
+// Boolean represents the literals 'true' and 'false' in the AST.
+type Boolean struct {
+	Token token.Token // The token.TRUE or token.FALSE token.
+	Value bool        // The boolean value of the literal.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (b *Boolean) expressionNode() {}
+
+// TokenLiteral returns the literal value of the boolean's token.
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+
+// Pos returns the start of the literal.
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+
+// End returns the end of the literal.
+func (b *Boolean) End() token.Position { return b.Token.End }
+
+// String returns "true" or "false".
+func (b *Boolean) String() string { return b.Token.Literal }
+
+// BlockStatement represents a sequence of statements enclosed in braces, e.g. the body of an if or a function.
+type BlockStatement struct {
+	Token      token.Token // The '{' token.
+	Statements []Statement // The statements inside the braces.
+	Rbrace     token.Token // The closing '}' token.
+}
+
+// statementNode is a dummy method that helps the Go compiler recognize this as a Statement node.
+func (bs *BlockStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the '{' token.
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// Pos returns the position of the opening brace.
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+
+// End returns the position after the closing brace.
+func (bs *BlockStatement) End() token.Position { return bs.Rbrace.End }
+
+// String writes out the String() of every statement in the block.
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
+// IfExpression represents 'if (<condition>) <consequence> else <alternative>'.
+// In Monkey if is an expression, so it produces the value of the branch that was taken.
+// The else branch is optional, in which case Alternative is nil.
+type IfExpression struct {
+	Token       token.Token     // The 'if' token.
+	Condition   Expression      // The condition between the parentheses.
+	Consequence *BlockStatement // The block evaluated when the condition is truthy.
+	Alternative *BlockStatement // The block evaluated otherwise, or nil if there is no else.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (ie *IfExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the 'if' token.
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+
+// Pos returns the position of the 'if' keyword.
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
+// End returns the end of the last branch.
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
+
+// String renders the condition and both branches.
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// FunctionLiteral represents 'fn(<parameters>) <body>'.
+// Functions are values in Monkey, so a function literal is an expression like any other.
+type FunctionLiteral struct {
+	Token      token.Token     // The 'fn' token.
+	Parameters []*Identifier   // The names of the parameters, in order.
+	Body       *BlockStatement // The body of the function.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (fl *FunctionLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the 'fn' token.
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+// Pos returns the position of the 'fn' keyword.
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+
+// End returns the end of the body.
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
+// String renders the parameter list followed by the body.
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+// CallExpression represents '<function>(<arguments>)'.
+// Function is either an identifier bound to a function or a function literal.
+type CallExpression struct {
+	Token     token.Token  // The '(' token.
+	Function  Expression   // The expression that produces the function being called.
+	Arguments []Expression // The arguments, in order.
+	Rparen    token.Token  // The closing ')' token.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (ce *CallExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '(' token.
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+
+// Pos returns the start of the expression producing the function.
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+
+// End returns the position after the closing parenthesis.
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End }
+
+// String renders the function followed by the argument list.
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// BadStatement is a placeholder for a statement that could not be parsed.
+// The parser skips ahead to the next statement boundary when it finds an error and inserts a
+// BadStatement covering the skipped tokens, so the rest of the program still ends up in the AST.
+type BadStatement struct {
+	Token token.Token // The first token of the statement.
+	To    token.Token // The last token that was skipped.
+}
+
+// statementNode is a dummy method that helps the Go compiler recognize this as a Statement node.
+func (bs *BadStatement) statementNode() {}
+
+// TokenLiteral returns the literal value of the first token of the statement.
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// String returns a marker, since the source of the statement couldn't be understood.
+func (bs *BadStatement) String() string { return "<bad statement>" }
+
+// Pos returns the start of the first skipped token.
+func (bs *BadStatement) Pos() token.Position { return bs.Token.Pos }
+
+// End returns the end of the last skipped token.
+func (bs *BadStatement) End() token.Position { return bs.To.End }
+
+// BadExpression is a placeholder for an expression that could not be parsed,
+// e.g. because its first token cannot start an expression.
+type BadExpression struct {
+	Token token.Token // The token where an expression was expected.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (be *BadExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the offending token.
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+
+// String returns a marker, since the source of the expression couldn't be understood.
+func (be *BadExpression) String() string { return "<bad expression>" }
+
+// Pos returns the start of the offending token.
+func (be *BadExpression) Pos() token.Position { return be.Token.Pos }
+
+// End returns the end of the offending token.
+func (be *BadExpression) End() token.Position { return be.Token.End }
+
+// StringLiteral represents a double-quoted string such as "hello\n" in the AST.
+type StringLiteral struct {
+	Token token.Token // The token.STRING token.
+	Value string      // The content of the string, with escape sequences resolved.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (sl *StringLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the string's token, which is its decoded content.
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// String returns the string quoted and escaped, the way it could be written in Monkey source.
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+
+// Pos returns the position of the opening quote.
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+
+// End returns the position after the closing quote.
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+// quote wraps s in double quotes, escaping the characters that can't appear in a string literal as-is.
+// Control characters other than newline and tab are written as \u{...} escapes.
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			out.WriteString(fmt.Sprintf(`\u{%x}`, r))
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
+// ArrayLiteral represents '[<expression>, <expression>, ...]'.
+type ArrayLiteral struct {
+	Token    token.Token  // The '[' token.
+	Elements []Expression // The elements, in order.
+	Rbracket token.Token  // The closing ']' token.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (al *ArrayLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '[' token.
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+
+// String renders the elements between brackets.
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Pos returns the position of the opening bracket.
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+
+// End returns the position after the closing bracket.
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
+
+// IndexExpression represents '<expression>[<expression>]', e.g. 'myArray[0]'.
+type IndexExpression struct {
+	Token    token.Token // The '[' token.
+	Left     Expression  // The expression being indexed.
+	Index    Expression  // The index.
+	Rbracket token.Token // The closing ']' token.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (ie *IndexExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '[' token.
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+
+// String wraps the expression in parentheses so the way it was grouped by the parser is visible.
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// Pos returns the start of the expression being indexed.
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+
+// End returns the position after the closing bracket.
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
+
+// SliceExpression represents '<expression>[<low>:<high>]', e.g. 'myArray[1:3]'.
+// Both bounds are optional and nil when they were left out.
+type SliceExpression struct {
+	Token    token.Token // The '[' token.
+	Left     Expression  // The expression being sliced.
+	Low      Expression  // The first index of the slice, or nil.
+	High     Expression  // The index after the last one of the slice, or nil.
+	Rbracket token.Token // The closing ']' token.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (se *SliceExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '[' token.
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String wraps the expression in parentheses so the way it was grouped by the parser is visible.
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// Pos returns the start of the expression being sliced.
+func (se *SliceExpression) Pos() token.Position { return se.Left.Pos() }
+
+// End returns the position after the closing bracket.
+func (se *SliceExpression) End() token.Position { return se.Rbracket.End }
+
+// HashLiteral represents '{<key>: <value>, ...}'.
+// The pairs are kept in the order they were written, so the literal can be printed back as it was.
+type HashLiteral struct {
+	Token  token.Token // The '{' token.
+	Pairs  []HashPair  // The key/value pairs, in source order.
+	Rbrace token.Token // The closing '}' token.
+}
+
+// HashPair is a single '<key>: <value>' entry of a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (hl *HashLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the '{' token.
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+
+// String renders the pairs between braces.
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Pos returns the position of the opening brace.
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+
+// End returns the position after the closing brace.
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
+
+// MacroLiteral represents 'macro(<parameters>) <body>'.
+// Macros look like functions, but they are called while the program is being expanded,
+// with the syntax trees of their arguments, and return the code that replaces the call.
+type MacroLiteral struct {
+	Token      token.Token     // The 'macro' token.
+	Parameters []*Identifier   // The names of the parameters, in order.
+	Body       *BlockStatement // The body of the macro.
+}
+
+// expressionNode is a dummy method that helps the Go compiler recognize this as an Expression node.
+func (ml *MacroLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value of the 'macro' token.
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+
+// Pos returns the position of the 'macro' keyword.
+func (ml *MacroLiteral) Pos() token.Position { return ml.Token.Pos }
+
+// End returns the end of the body.
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
+
+// String renders the parameter list followed by the body.
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
@@ -0,0 +1,529 @@
+package ast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/token"
+	"strings"
+)
+
+// jsonNode is the JSON form of every kind of node; each kind only uses some of the fields.
+// Lists are pointers to slices so nil and empty lists stay apart: nil encodes as null.
+type jsonNode struct {
+	Kind  string          `json:"kind"`
+	Pos   jsonPosition    `json:"pos"`
+	End   jsonPosition    `json:"end"`
+	Token *jsonToken      `json:"token,omitempty"`
+	Name  *jsonNode       `json:"name,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	Operator    string    `json:"operator,omitempty"`
+	Left        *jsonNode `json:"left,omitempty"`
+	Right       *jsonNode `json:"right,omitempty"`
+	ReturnValue *jsonNode `json:"returnValue,omitempty"`
+	Expression  *jsonNode `json:"expression,omitempty"`
+	Condition   *jsonNode `json:"condition,omitempty"`
+	Consequence *jsonNode `json:"consequence,omitempty"`
+	Alternative *jsonNode `json:"alternative,omitempty"`
+	Function    *jsonNode `json:"function,omitempty"`
+	Index       *jsonNode `json:"index,omitempty"`
+	Low         *jsonNode `json:"low,omitempty"`
+	High        *jsonNode `json:"high,omitempty"`
+	Body        *jsonNode `json:"body,omitempty"`
+
+	Statements *[]*jsonNode  `json:"statements,omitempty"`
+	Parameters *[]*jsonNode  `json:"parameters,omitempty"`
+	Arguments  *[]*jsonNode  `json:"arguments,omitempty"`
+	Elements   *[]*jsonNode  `json:"elements,omitempty"`
+	Pairs      *[]jsonPair   `json:"pairs,omitempty"`
+	Comments   []jsonComment `json:"comments,omitempty"`
+
+	Rbrace   *jsonToken `json:"rbrace,omitempty"`
+	Rparen   *jsonToken `json:"rparen,omitempty"`
+	Rbracket *jsonToken `json:"rbracket,omitempty"`
+	To       *jsonToken `json:"to,omitempty"`
+}
+
+// jsonPair is the JSON form of a HashPair.
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// jsonToken is the JSON form of a token.Token.
+type jsonToken struct {
+	Type     string        `json:"type"`
+	Literal  string        `json:"literal"`
+	Pos      jsonPosition  `json:"pos"`
+	End      jsonPosition  `json:"end"`
+	Leading  []jsonComment `json:"leading,omitempty"`
+	Trailing []jsonComment `json:"trailing,omitempty"`
+}
+
+// jsonComment is the JSON form of a token.Comment.
+type jsonComment struct {
+	Text string       `json:"text"`
+	Pos  jsonPosition `json:"pos"`
+	End  jsonPosition `json:"end"`
+}
+
+// jsonPosition is the JSON form of a token.Position.
+type jsonPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// EncodeJSON returns the JSON encoding of the tree rooted at node.
+//
+// The encoding is meant for tools written in other languages, so it is lossless: decoding it
+// gives back exactly the tree that was encoded, tokens and comments included.
+// Every node is an object with
+//
+//   - "kind": the name of its Go type, e.g. "InfixExpression",
+//   - "pos" and "end": its span, for the convenience of readers (the decoder ignores them),
+//   - "token": the token stored in its Token field,
+//
+// followed by its other fields under their Go names in lower camel case, e.g. "returnValue".
+// Children are nested node objects, missing optional children are left out, and lists
+// of children are arrays. The "value" of a literal is a JSON string, number or boolean.
+//
+//	{"kind": "Identifier", "pos": {"offset": 4, "line": 1, "column": 5}, "end": ...,
+//	 "token": {"type": "IDENT", "literal": "x", "pos": ..., "end": ...}, "value": "x"}
+func EncodeJSON(node Node) ([]byte, error) {
+	if isNilNode(node) {
+		return nil, errors.New("ast: can't encode a nil node")
+	}
+	return json.Marshal(encodeNode(node))
+}
+
+// DecodeJSON rebuilds the tree encoded by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	var j jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("ast: %w", err)
+	}
+	return decodeNode(&j)
+}
+
+// encodeNode converts a node to its JSON form, or nil if it's missing.
+func encodeNode(node Node) *jsonNode {
+	if isNilNode(node) {
+		return nil
+	}
+
+	j := &jsonNode{Kind: kindOf(node), Pos: encodePosition(node.Pos()), End: encodePosition(node.End())}
+
+	switch node := node.(type) {
+	case *Program:
+		j.Statements = encodeList(node.Statements)
+		j.Comments = encodeComments(node.Comments)
+	case *LetStatement:
+		j.Token = encodeToken(node.Token)
+		j.Name = encodeNode(node.Name)
+		if child := encodeNode(node.Value); child != nil {
+			j.Value = mustMarshal(child)
+		}
+	case *ReturnStatement:
+		j.Token = encodeToken(node.Token)
+		j.ReturnValue = encodeNode(node.ReturnValue)
+	case *ExpressionStatement:
+		j.Token = encodeToken(node.Token)
+		j.Expression = encodeNode(node.Expression)
+	case *BlockStatement:
+		j.Token = encodeToken(node.Token)
+		j.Statements = encodeList(node.Statements)
+		j.Rbrace = encodeToken(node.Rbrace)
+	case *Identifier:
+		j.Token = encodeToken(node.Token)
+		j.Value = mustMarshal(node.Value)
+	case *IntegerLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Value = mustMarshal(node.Value)
+	case *StringLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Value = mustMarshal(node.Value)
+	case *Boolean:
+		j.Token = encodeToken(node.Token)
+		j.Value = mustMarshal(node.Value)
+	case *PrefixExpression:
+		j.Token = encodeToken(node.Token)
+		j.Operator = node.Operator
+		j.Right = encodeNode(node.Right)
+	case *InfixExpression:
+		j.Token = encodeToken(node.Token)
+		j.Left = encodeNode(node.Left)
+		j.Operator = node.Operator
+		j.Right = encodeNode(node.Right)
+	case *IfExpression:
+		j.Token = encodeToken(node.Token)
+		j.Condition = encodeNode(node.Condition)
+		j.Consequence = encodeNode(node.Consequence)
+		j.Alternative = encodeNode(node.Alternative)
+	case *FunctionLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Parameters = encodeList(node.Parameters)
+		j.Body = encodeNode(node.Body)
+	case *MacroLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Parameters = encodeList(node.Parameters)
+		j.Body = encodeNode(node.Body)
+	case *CallExpression:
+		j.Token = encodeToken(node.Token)
+		j.Function = encodeNode(node.Function)
+		j.Arguments = encodeList(node.Arguments)
+		j.Rparen = encodeToken(node.Rparen)
+	case *ArrayLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Elements = encodeList(node.Elements)
+		j.Rbracket = encodeToken(node.Rbracket)
+	case *IndexExpression:
+		j.Token = encodeToken(node.Token)
+		j.Left = encodeNode(node.Left)
+		j.Index = encodeNode(node.Index)
+		j.Rbracket = encodeToken(node.Rbracket)
+	case *SliceExpression:
+		j.Token = encodeToken(node.Token)
+		j.Left = encodeNode(node.Left)
+		j.Low = encodeNode(node.Low)
+		j.High = encodeNode(node.High)
+		j.Rbracket = encodeToken(node.Rbracket)
+	case *HashLiteral:
+		j.Token = encodeToken(node.Token)
+		var pairs []jsonPair
+		if node.Pairs != nil {
+			pairs = make([]jsonPair, len(node.Pairs))
+		}
+		for i, pair := range node.Pairs {
+			pairs[i] = jsonPair{Key: encodeNode(pair.Key), Value: encodeNode(pair.Value)}
+		}
+		j.Pairs = &pairs
+		j.Rbrace = encodeToken(node.Rbrace)
+	case *BadStatement:
+		j.Token = encodeToken(node.Token)
+		j.To = encodeToken(node.To)
+	case *BadExpression:
+		j.Token = encodeToken(node.Token)
+	default:
+		panic(fmt.Sprintf("ast.EncodeJSON: unexpected node type %T", node))
+	}
+
+	return j
+}
+
+// kindOf returns the name of the type of node without its package, e.g. "Identifier".
+func kindOf(node Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+// encodeList converts a list of nodes, keeping a nil list apart from an empty one.
+func encodeList[T Node](list []T) *[]*jsonNode {
+	var nodes []*jsonNode
+	if list != nil {
+		nodes = make([]*jsonNode, len(list))
+	}
+	for i, node := range list {
+		nodes[i] = encodeNode(node)
+	}
+	return &nodes
+}
+
+// encodeToken converts a token.
+func encodeToken(tok token.Token) *jsonToken {
+	return &jsonToken{
+		Type:     string(tok.Type),
+		Literal:  tok.Literal,
+		Pos:      encodePosition(tok.Pos),
+		End:      encodePosition(tok.End),
+		Leading:  encodeComments(tok.Leading),
+		Trailing: encodeComments(tok.Trailing),
+	}
+}
+
+// encodeComments converts a list of comments.
+func encodeComments(comments []token.Comment) []jsonComment {
+	if comments == nil {
+		return nil
+	}
+	list := make([]jsonComment, len(comments))
+	for i, c := range comments {
+		list[i] = jsonComment{Text: c.Text, Pos: encodePosition(c.Pos), End: encodePosition(c.End)}
+	}
+	return list
+}
+
+// encodePosition converts a position.
+func encodePosition(pos token.Position) jsonPosition {
+	return jsonPosition{Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
+
+// mustMarshal encodes a value that can always be encoded.
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// decodeNode converts the JSON form of a node back, or returns nil if it's missing.
+func decodeNode(j *jsonNode) (Node, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	// d collects the first error of the fields, so they can be decoded one after another.
+	d := &decoder{}
+	var node Node
+
+	switch j.Kind {
+	case "Program":
+		node = &Program{
+			Statements: decodeList(d, j.Statements, d.statement),
+			Comments:   decodeComments(j.Comments),
+		}
+	case "LetStatement":
+		n := &LetStatement{Token: d.token(j.Token), Name: d.identifier(j.Name)}
+		if j.Value != nil {
+			var value jsonNode
+			if err := json.Unmarshal(j.Value, &value); err != nil {
+				return nil, fmt.Errorf("ast: value of LetStatement: %w", err)
+			}
+			n.Value = d.expression(&value)
+		}
+		node = n
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: d.token(j.Token), ReturnValue: d.expression(j.ReturnValue)}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: d.token(j.Token), Expression: d.expression(j.Expression)}
+	case "BlockStatement":
+		node = &BlockStatement{
+			Token:      d.token(j.Token),
+			Statements: decodeList(d, j.Statements, d.statement),
+			Rbrace:     d.token(j.Rbrace),
+		}
+	case "Identifier":
+		n := &Identifier{Token: d.token(j.Token)}
+		d.value(j, &n.Value)
+		node = n
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Token: d.token(j.Token)}
+		d.value(j, &n.Value)
+		node = n
+	case "StringLiteral":
+		n := &StringLiteral{Token: d.token(j.Token)}
+		d.value(j, &n.Value)
+		node = n
+	case "Boolean":
+		n := &Boolean{Token: d.token(j.Token)}
+		d.value(j, &n.Value)
+		node = n
+	case "PrefixExpression":
+		node = &PrefixExpression{Token: d.token(j.Token), Operator: j.Operator, Right: d.expression(j.Right)}
+	case "InfixExpression":
+		node = &InfixExpression{
+			Token:    d.token(j.Token),
+			Left:     d.expression(j.Left),
+			Operator: j.Operator,
+			Right:    d.expression(j.Right),
+		}
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       d.token(j.Token),
+			Condition:   d.expression(j.Condition),
+			Consequence: d.block(j.Consequence),
+			Alternative: d.block(j.Alternative),
+		}
+	case "FunctionLiteral":
+		node = &FunctionLiteral{
+			Token:      d.token(j.Token),
+			Parameters: decodeList(d, j.Parameters, d.identifier),
+			Body:       d.block(j.Body),
+		}
+	case "MacroLiteral":
+		node = &MacroLiteral{
+			Token:      d.token(j.Token),
+			Parameters: decodeList(d, j.Parameters, d.identifier),
+			Body:       d.block(j.Body),
+		}
+	case "CallExpression":
+		node = &CallExpression{
+			Token:     d.token(j.Token),
+			Function:  d.expression(j.Function),
+			Arguments: decodeList(d, j.Arguments, d.expression),
+			Rparen:    d.token(j.Rparen),
+		}
+	case "ArrayLiteral":
+		node = &ArrayLiteral{
+			Token:    d.token(j.Token),
+			Elements: decodeList(d, j.Elements, d.expression),
+			Rbracket: d.token(j.Rbracket),
+		}
+	case "IndexExpression":
+		node = &IndexExpression{
+			Token:    d.token(j.Token),
+			Left:     d.expression(j.Left),
+			Index:    d.expression(j.Index),
+			Rbracket: d.token(j.Rbracket),
+		}
+	case "SliceExpression":
+		node = &SliceExpression{
+			Token:    d.token(j.Token),
+			Left:     d.expression(j.Left),
+			Low:      d.expression(j.Low),
+			High:     d.expression(j.High),
+			Rbracket: d.token(j.Rbracket),
+		}
+	case "HashLiteral":
+		n := &HashLiteral{Token: d.token(j.Token), Rbrace: d.token(j.Rbrace)}
+		if j.Pairs != nil && *j.Pairs != nil {
+			n.Pairs = make([]HashPair, len(*j.Pairs))
+			for i, pair := range *j.Pairs {
+				n.Pairs[i] = HashPair{Key: d.expression(pair.Key), Value: d.expression(pair.Value)}
+			}
+		}
+		node = n
+	case "BadStatement":
+		node = &BadStatement{Token: d.token(j.Token), To: d.token(j.To)}
+	case "BadExpression":
+		node = &BadExpression{Token: d.token(j.Token)}
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", j.Kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// decoder decodes the fields of a node, remembering the first error.
+type decoder struct {
+	err error
+}
+
+// node decodes a child, or returns nil after an earlier error.
+func (d *decoder) node(j *jsonNode) Node {
+	if d.err != nil {
+		return nil
+	}
+	node, err := decodeNode(j)
+	if err != nil {
+		d.err = err
+	}
+	return node
+}
+
+// expression decodes a child that has to be an expression.
+func (d *decoder) expression(j *jsonNode) Expression {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("expression", j)
+	}
+	return e
+}
+
+// statement decodes a child that has to be a statement.
+func (d *decoder) statement(j *jsonNode) Statement {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	s, ok := node.(Statement)
+	if !ok {
+		d.fail("statement", j)
+	}
+	return s
+}
+
+// identifier decodes a child that has to be an identifier.
+func (d *decoder) identifier(j *jsonNode) *Identifier {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail("Identifier", j)
+	}
+	return ident
+}
+
+// block decodes a child that has to be a block statement.
+func (d *decoder) block(j *jsonNode) *BlockStatement {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("BlockStatement", j)
+	}
+	return block
+}
+
+// fail records that a child of the wrong kind was found.
+func (d *decoder) fail(expected string, j *jsonNode) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: expected %s, got %s", expected, j.Kind)
+	}
+}
+
+// value decodes the value of a literal into v.
+func (d *decoder) value(j *jsonNode, v any) {
+	if d.err != nil || j.Value == nil {
+		return
+	}
+	if err := json.Unmarshal(j.Value, v); err != nil {
+		d.err = fmt.Errorf("ast: value of %s: %w", j.Kind, err)
+	}
+}
+
+// token converts a token back. A missing token is the zero token.
+func (d *decoder) token(j *jsonToken) token.Token {
+	if j == nil {
+		return token.Token{}
+	}
+	return token.Token{
+		Type:     token.TokenType(j.Type),
+		Literal:  j.Literal,
+		Pos:      decodePosition(j.Pos),
+		End:      decodePosition(j.End),
+		Leading:  decodeComments(j.Leading),
+		Trailing: decodeComments(j.Trailing),
+	}
+}
+
+// decodeList decodes a list of children with decode, keeping a nil list apart from an empty one.
+func decodeList[T Node](d *decoder, list *[]*jsonNode, decode func(*jsonNode) T) []T {
+	if list == nil || *list == nil {
+		return nil
+	}
+	nodes := make([]T, len(*list))
+	for i, j := range *list {
+		nodes[i] = decode(j)
+	}
+	return nodes
+}
+
+// decodeComments converts a list of comments back.
+func decodeComments(list []jsonComment) []token.Comment {
+	if list == nil {
+		return nil
+	}
+	comments := make([]token.Comment, len(list))
+	for i, c := range list {
+		comments[i] = token.Comment{Text: c.Text, Pos: decodePosition(c.Pos), End: decodePosition(c.End)}
+	}
+	return comments
+}
+
+// decodePosition converts a position back.
+func decodePosition(pos jsonPosition) token.Position {
+	return token.Position{Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
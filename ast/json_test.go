@@ -0,0 +1,89 @@
+package ast_test
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"// Only a comment.",
+		`// Adds things.
+let add = fn(a, b) { a + b }; /* trailing */
+let result = add(1, -2) * 3 % 4;
+return if (result >= 0 && !false) { "yes\n" } else { [1, 2][0:1] };`,
+		`let h = {"a": 1, true: [], 2: {}}; h["a"]; fn() {}(); x[:]; ~1 << 2;`,
+		"let = 5; let x 1; f(,); 5 +;",
+		"let m = macro(a, b) { quote(unquote(a) + unquote(b)) }; m(1, 2);",
+	}
+
+	for _, input := range inputs {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("EncodeJSON(%q) failed: %s", input, err)
+		}
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("DecodeJSON failed for %q: %s\n%s", input, err, data)
+		}
+
+		if !reflect.DeepEqual(decoded, ast.Node(program)) {
+			t.Errorf("tree of %q changed after a round trip.\nwant=%#v\ngot =%#v", input, program, decoded)
+		}
+
+		again, _ := ast.EncodeJSON(decoded)
+		if string(again) != string(data) {
+			t.Errorf("encoding of %q changed after a round trip.\nwant=%s\ngot =%s", input, data, again)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	program := parser.New(lexer.New("x;")).ParseProgram()
+
+	data, err := ast.EncodeJSON(program.Statements[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"kind":"ExpressionStatement",` +
+		`"pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2},` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}},` +
+		`"expression":{"kind":"Identifier",` +
+		`"pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2},` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}},` +
+		`"value":"x"}}`
+	if string(data) != expected {
+		t.Errorf("wrong encoding.\nwant=%s\ngot =%s", expected, data)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Program"`, "unexpected end of JSON input"},
+		{`{"kind": "Nonsense"}`, `unknown node kind "Nonsense"`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier"}]}`, "expected statement, got Identifier"},
+		{`{"kind": "PrefixExpression", "right": {"kind": "BadStatement"}}`, "expected expression, got BadStatement"},
+		{`{"kind": "FunctionLiteral", "parameters": [{"kind": "Boolean"}]}`, "expected Identifier, got Boolean"},
+		{`{"kind": "IfExpression", "consequence": {"kind": "ArrayLiteral"}}`, "expected BlockStatement, got ArrayLiteral"},
+		{`{"kind": "IntegerLiteral", "value": "five"}`, "value of IntegerLiteral"},
+		{`{"kind": "LetStatement", "value": {"kind": "LetStatement"}}`, "expected expression, got LetStatement"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
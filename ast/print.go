@@ -0,0 +1,145 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Fprint writes a readable dump of the tree rooted at node to w: one node per line,
+// indented by depth, with its kind, its span and, for leaves and operators, its value.
+// Children are labelled with the field of their parent they're stored in.
+//
+//	Program 1:1-1:10
+//	  LetStatement 1:1-1:10
+//	    Name: Identifier 1:5-1:6 x
+//	    Value: IntegerLiteral 1:9-1:10 5
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{w: w}
+	p.print("", node, 0)
+	return p.err
+}
+
+// printer holds the state of Fprint. The first write error sticks and ends the output.
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+// print writes node and, indented one level deeper, its children.
+func (p *printer) print(label string, node Node, depth int) {
+	if p.err != nil {
+		return
+	}
+
+	line := fmt.Sprintf("%s%s%s %s-%s", strings.Repeat("  ", depth), label, kindOf(node), node.Pos(), node.End())
+	if detail := nodeDetail(node); detail != "" {
+		line += " " + detail
+	}
+	if _, err := fmt.Fprintln(p.w, line); err != nil {
+		p.err = err
+		return
+	}
+
+	depth++
+	switch node := node.(type) {
+	case *Program:
+		for i, s := range node.Statements {
+			p.print(fmt.Sprintf("Statements[%d]: ", i), s, depth)
+		}
+	case *LetStatement:
+		p.child("Name: ", node.Name, depth)
+		p.child("Value: ", node.Value, depth)
+	case *ReturnStatement:
+		p.child("ReturnValue: ", node.ReturnValue, depth)
+	case *ExpressionStatement:
+		p.child("Expression: ", node.Expression, depth)
+	case *BlockStatement:
+		for i, s := range node.Statements {
+			p.print(fmt.Sprintf("Statements[%d]: ", i), s, depth)
+		}
+	case *PrefixExpression:
+		p.child("Right: ", node.Right, depth)
+	case *InfixExpression:
+		p.child("Left: ", node.Left, depth)
+		p.child("Right: ", node.Right, depth)
+	case *IfExpression:
+		p.child("Condition: ", node.Condition, depth)
+		p.child("Consequence: ", node.Consequence, depth)
+		p.child("Alternative: ", node.Alternative, depth)
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			p.print(fmt.Sprintf("Parameters[%d]: ", i), param, depth)
+		}
+		p.child("Body: ", node.Body, depth)
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			p.print(fmt.Sprintf("Parameters[%d]: ", i), param, depth)
+		}
+		p.child("Body: ", node.Body, depth)
+	case *CallExpression:
+		p.child("Function: ", node.Function, depth)
+		for i, a := range node.Arguments {
+			p.print(fmt.Sprintf("Arguments[%d]: ", i), a, depth)
+		}
+	case *ArrayLiteral:
+		for i, el := range node.Elements {
+			p.print(fmt.Sprintf("Elements[%d]: ", i), el, depth)
+		}
+	case *IndexExpression:
+		p.child("Left: ", node.Left, depth)
+		p.child("Index: ", node.Index, depth)
+	case *SliceExpression:
+		p.child("Left: ", node.Left, depth)
+		p.child("Low: ", node.Low, depth)
+		p.child("High: ", node.High, depth)
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			p.print(fmt.Sprintf("Pairs[%d].Key: ", i), pair.Key, depth)
+			p.print(fmt.Sprintf("Pairs[%d].Value: ", i), pair.Value, depth)
+		}
+	}
+}
+
+// child prints an optional child, skipping it when it's missing.
+func (p *printer) child(label string, node Node, depth int) {
+	if isNilNode(node) {
+		return
+	}
+	p.print(label, node, depth)
+}
+
+// isNilNode reports whether node is nil. Fields with a concrete type like *BlockStatement
+// turn into a non-nil Node holding a nil pointer when they're passed on, so those are checked too.
+func isNilNode(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	}
+	return false
+}
+
+// nodeDetail returns the value of a leaf or the operator of an expression, if the node has one.
+func nodeDetail(node Node) string {
+	switch node := node.(type) {
+	case *Identifier:
+		return node.Value
+	case *IntegerLiteral:
+		return fmt.Sprintf("%d", node.Value)
+	case *StringLiteral:
+		return quote(node.Value)
+	case *Boolean:
+		return fmt.Sprintf("%t", node.Value)
+	case *PrefixExpression:
+		return node.Operator
+	case *InfixExpression:
+		return node.Operator
+	case *BadStatement, *BadExpression:
+		return node.String()
+	}
+	return ""
+}
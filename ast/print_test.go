@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"bytes"
+	"interpreter/token"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	pos := func(line, column int) token.Position {
+		return token.Position{Line: line, Column: column}
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(1, 1), End: pos(1, 4)},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Pos: pos(1, 5), End: pos(1, 6)},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Pos: pos(1, 9), End: pos(1, 10)},
+					Operator: "-",
+					Right: &StringLiteral{
+						Token: token.Token{Type: token.STRING, Literal: "a\n", Pos: pos(1, 10), End: pos(1, 15)},
+						Value: "a\n",
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1-1:15
+  Statements[0]: LetStatement 1:1-1:15
+    Name: Identifier 1:5-1:6 x
+    Value: PrefixExpression 1:9-1:15 -
+      Right: StringLiteral 1:10-1:15 "a\n"
+`
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong dump.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,348 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called by Walk for every node it reaches.
+// If the returned visitor w is not nil, Walk visits the children of the node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, children in source order:
+// it starts by calling v.Visit(node), and missing optional children, like the alternative
+// of an if without else, are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		walkStatements(v, node.Statements)
+	case *LetStatement:
+		walkChild(v, node.Name)
+		walkChild(v, node.Value)
+	case *ReturnStatement:
+		walkChild(v, node.ReturnValue)
+	case *ExpressionStatement:
+		walkChild(v, node.Expression)
+	case *BlockStatement:
+		walkStatements(v, node.Statements)
+	case *PrefixExpression:
+		walkChild(v, node.Right)
+	case *InfixExpression:
+		walkChild(v, node.Left)
+		walkChild(v, node.Right)
+	case *IfExpression:
+		walkChild(v, node.Condition)
+		walkChild(v, node.Consequence)
+		walkChild(v, node.Alternative)
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			walkChild(v, param)
+		}
+		walkChild(v, node.Body)
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			walkChild(v, param)
+		}
+		walkChild(v, node.Body)
+	case *CallExpression:
+		walkChild(v, node.Function)
+		walkExpressions(v, node.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, node.Elements)
+	case *IndexExpression:
+		walkChild(v, node.Left)
+		walkChild(v, node.Index)
+	case *SliceExpression:
+		walkChild(v, node.Left)
+		walkChild(v, node.Low)
+		walkChild(v, node.High)
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			walkChild(v, pair.Key)
+			walkChild(v, pair.Value)
+		}
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *BadStatement, *BadExpression:
+		// Leaves have no children.
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	v.Visit(nil)
+}
+
+// walkChild walks an optional child, skipping it when it's missing.
+func walkChild(v Visitor, node Node) {
+	if !isNilNode(node) {
+		Walk(v, node)
+	}
+}
+
+// walkStatements walks every statement of a list.
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		walkChild(v, s)
+	}
+}
+
+// walkExpressions walks every expression of a list.
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkChild(v, e)
+	}
+}
+
+// inspector turns a function into a Visitor for Inspect.
+type inspector func(Node) bool
+
+// Visit calls f and keeps walking into the children of node if it returns true.
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order, calling f(node) for every node.
+// If f returns true, Inspect goes on with the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// A ModifierFunc returns the node that replaces node, or node itself to keep it.
+// Returning nil removes the node, see Modify.
+type ModifierFunc func(node Node) Node
+
+// Modify rebuilds the tree rooted at node bottom-up: the children of every node are modified
+// first and stored back into it, then the node itself is passed to modifier, whose result
+// takes its place. The nodes are updated in place, and the new root is returned.
+//
+// A replacement has to fit the field it goes into: an expression can only be replaced
+// by an expression, and the name of a let statement only by an identifier.
+// A nil replacement removes the node: it's dropped from lists, like the statements
+// of a block or the arguments of a call, and leaves optional children, like the alternative
+// of an if, missing. Modify panics when a replacement doesn't fit or a required child is removed.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		node.Statements = modifyList(node.Statements, modifier)
+	case *LetStatement:
+		node.Name = modifyChild(node.Name, modifier)
+		node.Value = modifyChild(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modifyChild(node.ReturnValue, modifier)
+	case *ExpressionStatement:
+		node.Expression = modifyChild(node.Expression, modifier)
+	case *BlockStatement:
+		node.Statements = modifyList(node.Statements, modifier)
+	case *PrefixExpression:
+		node.Right = modifyChild(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modifyChild(node.Left, modifier)
+		node.Right = modifyChild(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modifyChild(node.Condition, modifier)
+		node.Consequence = modifyChild(node.Consequence, modifier)
+		node.Alternative = modifyOptional(node.Alternative, modifier)
+	case *FunctionLiteral:
+		node.Parameters = modifyList(node.Parameters, modifier)
+		node.Body = modifyChild(node.Body, modifier)
+	case *MacroLiteral:
+		node.Parameters = modifyList(node.Parameters, modifier)
+		node.Body = modifyChild(node.Body, modifier)
+	case *CallExpression:
+		node.Function = modifyChild(node.Function, modifier)
+		node.Arguments = modifyList(node.Arguments, modifier)
+	case *ArrayLiteral:
+		node.Elements = modifyList(node.Elements, modifier)
+	case *IndexExpression:
+		node.Left = modifyChild(node.Left, modifier)
+		node.Index = modifyChild(node.Index, modifier)
+	case *SliceExpression:
+		node.Left = modifyChild(node.Left, modifier)
+		node.Low = modifyOptional(node.Low, modifier)
+		node.High = modifyOptional(node.High, modifier)
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			node.Pairs[i].Key = modifyChild(pair.Key, modifier)
+			node.Pairs[i].Value = modifyChild(pair.Value, modifier)
+		}
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *BadStatement, *BadExpression:
+		// Leaves have no children.
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", node))
+	}
+
+	return modifier(node)
+}
+
+// modifyChild modifies a required child, which the modifier must not remove.
+// A child that is already missing, as in trees with syntax errors, is left alone.
+// T is the type of the field the child is stored in.
+func modifyChild[T Node](child T, modifier ModifierFunc) T {
+	replacement := modifyOptional(child, modifier)
+	if isNilNode(replacement) && !isNilNode(child) {
+		panic(fmt.Sprintf("ast.Modify: can't remove %T, it isn't optional", child))
+	}
+	return replacement
+}
+
+// modifyOptional modifies an optional child, leaving it alone when it's missing.
+// It returns the zero T if the modifier removed the child.
+func modifyOptional[T Node](child T, modifier ModifierFunc) T {
+	if isNilNode(child) {
+		return child
+	}
+
+	result := Modify(child, modifier)
+	if isNilNode(result) {
+		var missing T
+		return missing
+	}
+	replacement, ok := result.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: can't replace %T with %T", child, result))
+	}
+	return replacement
+}
+
+// modifyList modifies every element of a list in place and returns the list without
+// the elements the modifier removed.
+func modifyList[T Node](list []T, modifier ModifierFunc) []T {
+	kept := list[:0]
+	for _, child := range list {
+		if replacement := modifyOptional(child, modifier); !isNilNode(replacement) {
+			kept = append(kept, replacement)
+		}
+	}
+	return kept
+}
+
+// Copy returns a deep copy of the tree rooted at node, which can be changed, e.g. with Modify,
+// without changing the original. Only the comments of the tokens are shared.
+func Copy(node Node) Node {
+	if isNilNode(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		c := *node
+		c.Statements = copyList(node.Statements)
+		return &c
+	case *LetStatement:
+		c := *node
+		c.Name = copyChild(node.Name)
+		c.Value = copyChild(node.Value)
+		return &c
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = copyChild(node.ReturnValue)
+		return &c
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = copyChild(node.Expression)
+		return &c
+	case *BlockStatement:
+		c := *node
+		c.Statements = copyList(node.Statements)
+		return &c
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyChild(node.Right)
+		return &c
+	case *InfixExpression:
+		c := *node
+		c.Left = copyChild(node.Left)
+		c.Right = copyChild(node.Right)
+		return &c
+	case *IfExpression:
+		c := *node
+		c.Condition = copyChild(node.Condition)
+		c.Consequence = copyChild(node.Consequence)
+		c.Alternative = copyChild(node.Alternative)
+		return &c
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = copyList(node.Parameters)
+		c.Body = copyChild(node.Body)
+		return &c
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyList(node.Parameters)
+		c.Body = copyChild(node.Body)
+		return &c
+	case *CallExpression:
+		c := *node
+		c.Function = copyChild(node.Function)
+		c.Arguments = copyList(node.Arguments)
+		return &c
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyList(node.Elements)
+		return &c
+	case *IndexExpression:
+		c := *node
+		c.Left = copyChild(node.Left)
+		c.Index = copyChild(node.Index)
+		return &c
+	case *SliceExpression:
+		c := *node
+		c.Left = copyChild(node.Left)
+		c.Low = copyChild(node.Low)
+		c.High = copyChild(node.High)
+		return &c
+	case *HashLiteral:
+		c := *node
+		if node.Pairs != nil {
+			c.Pairs = make([]HashPair, len(node.Pairs))
+		}
+		for i, pair := range node.Pairs {
+			c.Pairs[i] = HashPair{Key: copyChild(pair.Key), Value: copyChild(pair.Value)}
+		}
+		return &c
+	case *Identifier:
+		c := *node
+		return &c
+	case *IntegerLiteral:
+		c := *node
+		return &c
+	case *StringLiteral:
+		c := *node
+		return &c
+	case *Boolean:
+		c := *node
+		return &c
+	case *BadStatement:
+		c := *node
+		return &c
+	case *BadExpression:
+		c := *node
+		return &c
+	}
+
+	panic(fmt.Sprintf("ast.Copy: unexpected node type %T", node))
+}
+
+// copyChild copies an optional child. T is the type of the field the child is stored in.
+func copyChild[T Node](child T) T {
+	if isNilNode(child) {
+		return child
+	}
+	return Copy(child).(T)
+}
+
+// copyList copies every element of a list, keeping a nil list apart from an empty one.
+func copyList[T Node](list []T) []T {
+	if list == nil {
+		return nil
+	}
+	c := make([]T, len(list))
+	for i, child := range list {
+		c[i] = copyChild(child)
+	}
+	return c
+}
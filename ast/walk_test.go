@@ -0,0 +1,343 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleTree returns a program that uses every kind of node.
+func sampleTree() *Program {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	integer := func(value int64) *IntegerLiteral { return &IntegerLiteral{Value: value} }
+
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ReturnStatement{ReturnValue: &InfixExpression{Left: ident("x"), Operator: "+", Right: integer(1)}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{&BadStatement{}}},
+			}},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: ident("f"),
+				Arguments: []Expression{
+					&PrefixExpression{Operator: "-", Right: integer(2)},
+					&IndexExpression{Left: &ArrayLiteral{Elements: []Expression{integer(3)}}, Index: integer(0)},
+					&SliceExpression{Left: &StringLiteral{Value: "abc"}, High: integer(1)},
+					&HashLiteral{Pairs: []HashPair{{Key: &StringLiteral{Value: "k"}, Value: &BadExpression{}}}},
+				},
+			}},
+			&LetStatement{Name: ident("m"), Value: &MacroLiteral{
+				Parameters: []*Identifier{ident("a")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("a")}}},
+			}},
+		},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var visited []string
+	Inspect(sampleTree(), func(node Node) bool {
+		if node == nil {
+			visited = append(visited, "end")
+			return false
+		}
+		visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		return true
+	})
+
+	expected := "Program LetStatement Identifier end FunctionLiteral Identifier end BlockStatement " +
+		"ReturnStatement InfixExpression Identifier end IntegerLiteral end end end end end end " +
+		"ExpressionStatement IfExpression Boolean end BlockStatement BadStatement end end end end " +
+		"ExpressionStatement CallExpression Identifier end PrefixExpression IntegerLiteral end end " +
+		"IndexExpression ArrayLiteral IntegerLiteral end end IntegerLiteral end end " +
+		"SliceExpression StringLiteral end IntegerLiteral end end " +
+		"HashLiteral StringLiteral end BadExpression end end end end " +
+		"LetStatement Identifier end MacroLiteral Identifier end BlockStatement ExpressionStatement Identifier end end end end end end"
+
+	if actual := strings.Join(visited, " "); actual != expected {
+		t.Errorf("wrong visiting order.\nwant=%s\ngot =%s", expected, actual)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	var identifiers []string
+	Inspect(sampleTree(), func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral:
+			return false
+		case *Identifier:
+			identifiers = append(identifiers, node.Value)
+		}
+		return true
+	})
+
+	if actual := strings.Join(identifiers, ","); actual != "f,f,m,a,a" {
+		t.Errorf("wrong identifiers outside functions. want=%q, got=%q", "f,f,m,a,a", actual)
+	}
+}
+
+// depthVisitor records the deepest nesting of blocks it reaches.
+type depthVisitor struct {
+	depth    int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if _, ok := node.(*BlockStatement); ok {
+		v.depth++
+		*v.maxDepth = max(*v.maxDepth, v.depth)
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &FunctionLiteral{Body: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{},
+				Alternative: &BlockStatement{},
+			}},
+		}}}},
+	}}
+
+	maxDepth := 0
+	Walk(depthVisitor{maxDepth: &maxDepth}, program)
+	if maxDepth != 2 {
+		t.Errorf("wrong block depth. want=2, got=%d", maxDepth)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&SliceExpression{Left: one(), High: one()},
+			&SliceExpression{Left: two(), High: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: &BlockStatement{}},
+			&IfExpression{Condition: two(), Consequence: &BlockStatement{}},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: one()},
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&CallExpression{Function: one(), Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: two(), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}, {Key: two(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}, {Key: two(), Value: two()}}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. want=%#v, got=%#v", tt.expected, modified)
+		}
+	}
+}
+
+func TestModifyIsBottomUp(t *testing.T) {
+	// Replace every sum of two integer literals with its value, which only folds
+	// nested sums completely if the operands were modified first.
+	fold := func(node Node) Node {
+		infix, ok := node.(*InfixExpression)
+		if !ok {
+			return node
+		}
+		left, leftOk := infix.Left.(*IntegerLiteral)
+		right, rightOk := infix.Right.(*IntegerLiteral)
+		if !leftOk || !rightOk {
+			return node
+		}
+		return &IntegerLiteral{Value: left.Value + right.Value}
+	}
+
+	sum := &InfixExpression{
+		Left:     &InfixExpression{Left: &IntegerLiteral{Value: 1}, Operator: "+", Right: &IntegerLiteral{Value: 2}},
+		Operator: "+",
+		Right:    &IntegerLiteral{Value: 3},
+	}
+
+	modified := Modify(sum, fold)
+	if !reflect.DeepEqual(modified, &IntegerLiteral{Value: 6}) {
+		t.Errorf("sum not folded. got=%#v", modified)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := sampleTree()
+	copied := Copy(original)
+
+	if !reflect.DeepEqual(copied, Node(original)) {
+		t.Fatalf("copy differs from the original.\nwant=%#v\ngot =%#v", original, copied)
+	}
+
+	// Changing every node of the copy must leave the original alone.
+	Modify(copied, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok {
+			ident.Value = "changed"
+		}
+		return node
+	})
+	if !reflect.DeepEqual(original, sampleTree()) {
+		t.Errorf("original changed with its copy: %s", original.String())
+	}
+}
+
+func TestModifyRejectsMisfits(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "can't replace *ast.Identifier with *ast.IntegerLiteral") {
+			t.Errorf("wrong panic: %v", r)
+		}
+	}()
+
+	// The name of a let statement has to stay an identifier.
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "y"}}
+	Modify(let, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+}
+
+func TestModifyRemovesNodes(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	integer := func(value int64) *IntegerLiteral { return &IntegerLiteral{Value: value} }
+	statement := func(e Expression) Statement { return &ExpressionStatement{Expression: e} }
+
+	program := &Program{Statements: []Statement{
+		statement(&StringLiteral{Value: "drop"}),
+		statement(&CallExpression{Function: ident("f"), Arguments: []Expression{ident("x"), integer(2), ident("x")}}),
+		statement(&ArrayLiteral{Elements: []Expression{ident("x")}}),
+		statement(&SliceExpression{Left: ident("a"), Low: ident("x"), High: integer(2)}),
+		statement(&IfExpression{
+			Condition:   ident("c"),
+			Consequence: &BlockStatement{Statements: []Statement{statement(&StringLiteral{Value: "drop"})}},
+			Alternative: &BlockStatement{Statements: []Statement{statement(ident("else"))}},
+		}),
+	}}
+
+	// Remove the identifier x, which only appears where it's optional, the statements "drop"
+	// and the alternative.
+	modified := Modify(program, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return nil
+		}
+		if block, ok := node.(*BlockStatement); ok && block.String() == "else" {
+			return nil
+		}
+		if stmt, ok := node.(*ExpressionStatement); ok {
+			if str, ok := stmt.Expression.(*StringLiteral); ok && str.Value == "drop" {
+				return nil
+			}
+		}
+		return node
+	})
+
+	expected := &Program{Statements: []Statement{
+		statement(&CallExpression{Function: ident("f"), Arguments: []Expression{integer(2)}}),
+		statement(&ArrayLiteral{Elements: []Expression{}}),
+		statement(&SliceExpression{Left: ident("a"), High: integer(2)}),
+		statement(&IfExpression{Condition: ident("c"), Consequence: &BlockStatement{Statements: []Statement{}}}),
+	}}
+	if !reflect.DeepEqual(modified, Node(expected)) {
+		t.Errorf("wrong program.\nwant=%#v\ngot =%#v", expected, modified)
+	}
+	_ = modified.String() // Nothing is left behind that printing could trip over.
+}
+
+func TestModifyRejectsRemovingRequiredChildren(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "can't remove *ast.IntegerLiteral, it isn't optional") {
+			t.Errorf("wrong panic: %v", r)
+		}
+	}()
+
+	// The value of a let statement can't be left out.
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &IntegerLiteral{Value: 1}}
+	Modify(let, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return nil
+		}
+		return node
+	})
+}
@@ -0,0 +1,323 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a flat sequence of bytecode instructions.
+// Every instruction is an opcode byte followed by its operands, encoded big-endian.
+type Instructions []byte
+
+// String disassembles the instructions, one per line: the offset, the opcode name and the operands.
+func (ins Instructions) String() string {
+	return ins.Disassemble(nil)
+}
+
+// Disassemble works like String, but calls annotate for every instruction and appends
+// whatever it returns as a comment, e.g. the value of a constant. annotate may be nil.
+func (ins Instructions) Disassemble(annotate func(op Opcode, operands []int) string) string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s is missing operand bytes\n", i, def.Name)
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		line := ins.fmtInstruction(def, operands)
+
+		if annotate != nil {
+			if note := annotate(Opcode(ins[i]), operands); note != "" {
+				line = fmt.Sprintf("%-24s ; %s", line, note)
+			}
+		}
+
+		fmt.Fprintf(&out, "%04d %s\n", i, line)
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// fmtInstruction renders an opcode name followed by its operands.
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s", def.Name)
+}
+
+// Opcode identifies an instruction. It's the first byte of every instruction.
+type Opcode byte
+
+// Opcodes of the virtual machine. The comment after each one lists its operands.
+const (
+	OpConstant Opcode = iota // constant index (2 bytes): push a constant
+	OpPop                    // pop the top of the stack
+
+	OpAdd    // pop two values, push left + right
+	OpSub    // pop two values, push left - right
+	OpMul    // pop two values, push left * right
+	OpDiv    // pop two values, push left / right
+	OpMod    // pop two values, push left % right
+	OpBitAnd // pop two values, push left & right
+	OpBitOr  // pop two values, push left | right
+	OpBitXor // pop two values, push left ^ right
+	OpShl    // pop two values, push left << right
+	OpShr    // pop two values, push left >> right
+
+	OpTrue  // push true
+	OpFalse // push false
+	OpNull  // push null
+
+	OpEqual        // pop two values, push left == right
+	OpNotEqual     // pop two values, push left != right
+	OpLessThan     // pop two values, push left < right
+	OpLessEqual    // pop two values, push left <= right
+	OpGreaterThan  // pop two values, push left > right
+	OpGreaterEqual // pop two values, push left >= right
+
+	OpMinus  // pop a value, push -value
+	OpBang   // pop a value, push !value
+	OpBitNot // pop a value, push ~value
+
+	OpJumpNotTruthy // target offset (2 bytes): pop a value, jump if it's falsy
+	OpJump          // target offset (2 bytes): jump unconditionally
+
+	OpGetGlobal // global index (2 bytes): push the global
+	OpSetGlobal // global index (2 bytes): pop a value into the global
+	OpGetLocal  // local index (1 byte): push the local of the current frame
+	OpSetLocal  // local index (1 byte): pop a value into the local of the current frame
+
+	OpGetBuiltin     // builtin index (1 byte): push the builtin
+	OpGetFree        // free variable index (1 byte): push a free variable of the current closure
+	OpCurrentClosure // push the closure that is currently executing, for recursion
+	OpCaptureLocal   // local index (1 byte): push the local of the current frame by reference, for OpClosure
+	OpCaptureFree    // free variable index (1 byte): push a free variable of the current closure by reference, for OpClosure
+
+	OpArray // element count (2 bytes): pop the elements, push an array
+	OpHash  // key and value count (2 bytes): pop the keys and values, push a hash
+	OpIndex // pop an index and a value, push value[index]
+	OpSlice // bound flags (1 byte): pop the bounds that are present and a value, push value[low:high]
+
+	OpCall        // argument count (1 byte): call the function below the arguments
+	OpReturnValue // pop a value and return it from the current function
+	OpReturn      // return null from the current function
+	OpClosure     // constant index (2 bytes), free variable count (1 byte): pop the captured variables, push a closure
+)
+
+// Flags of the OpSlice operand, telling which bounds of the slice are on the stack.
+const (
+	SliceLow  = 1 << 0
+	SliceHigh = 1 << 1
+)
+
+// Definition describes an opcode: its readable name and how many bytes each of its operands takes up.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:    {"OpAdd", []int{}},
+	OpSub:    {"OpSub", []int{}},
+	OpMul:    {"OpMul", []int{}},
+	OpDiv:    {"OpDiv", []int{}},
+	OpMod:    {"OpMod", []int{}},
+	OpBitAnd: {"OpBitAnd", []int{}},
+	OpBitOr:  {"OpBitOr", []int{}},
+	OpBitXor: {"OpBitXor", []int{}},
+	OpShl:    {"OpShl", []int{}},
+	OpShr:    {"OpShr", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus:  {"OpMinus", []int{}},
+	OpBang:   {"OpBang", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpSlice: {"OpSlice", []int{1}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+}
+
+// Width returns how many bytes the operands of the instruction take up together.
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
+
+// Lookup returns the definition of op, or an error if op isn't a known opcode.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// MaxOperand returns the largest value an operand of width bytes can hold.
+func MaxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+// CheckOperands returns an error if operands can't be encoded for op: op isn't a known opcode,
+// the number of operands is wrong or one of them doesn't fit into its width.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("opcode %d undefined", op)
+	}
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Errorf("%s takes %d operand(s), got %d", def.Name, len(def.OperandWidths), len(operands))
+	}
+
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		if o < 0 || o > MaxOperand(width) {
+			return fmt.Errorf("operand %d of %s doesn't fit into %d byte(s): %d", i, def.Name, width, o)
+		}
+	}
+	return nil
+}
+
+// Make encodes an instruction from an opcode and its operands.
+// It refuses to encode anything CheckOperands rejects, instead of truncating operands that don't fit,
+// and returns an empty slice then.
+func Make(op Opcode, operands ...int) []byte {
+	if CheckOperands(op, operands...) != nil {
+		return []byte{}
+	}
+	def := definitions[op]
+
+	instructionLen := 1 + def.Width()
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def from ins,
+// which starts right after the opcode. It also returns how many bytes the operands took up.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// LineEntry says that the instructions from Offset on were compiled from source line Line.
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// LineTable maps instruction offsets back to source lines. It's debug information:
+// the entries are sorted by offset and a new one only starts where the line changes.
+type LineTable []LineEntry
+
+// Line returns the source line of the instruction at offset, or 0 if it isn't known.
+func (t LineTable) Line(offset int) int {
+	line := 0
+	for _, entry := range t {
+		if entry.Offset > offset {
+			break
+		}
+		line = entry.Line
+	}
+	return line
+}
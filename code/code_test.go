@@ -0,0 +1,186 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpSlice, []int{SliceLow | SliceHigh}, []byte{byte(OpSlice), 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestMakeRefusesOperandsThatDontFit(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		err      string
+	}{
+		{OpConstant, []int{65535}, ""},
+		{OpConstant, []int{65536}, "operand 0 of OpConstant doesn't fit into 2 byte(s): 65536"},
+		{OpJump, []int{-1}, "operand 0 of OpJump doesn't fit into 2 byte(s): -1"},
+		{OpCall, []int{255}, ""},
+		{OpCall, []int{256}, "operand 0 of OpCall doesn't fit into 1 byte(s): 256"},
+		{OpClosure, []int{65535, 256}, "operand 1 of OpClosure doesn't fit into 1 byte(s): 256"},
+		{OpAdd, []int{1}, "OpAdd takes 0 operand(s), got 1"},
+		{OpConstant, []int{}, "OpConstant takes 1 operand(s), got 0"},
+		{Opcode(255), []int{}, "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		err := CheckOperands(tt.op, tt.operands...)
+		instruction := Make(tt.op, tt.operands...)
+
+		if tt.err == "" {
+			if err != nil || len(instruction) == 0 {
+				t.Errorf("%v %v rejected: %v", tt.op, tt.operands, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("wrong error for %v %v. want=%q, got=%v", tt.op, tt.operands, tt.err, err)
+		}
+		if len(instruction) != 0 {
+			t.Errorf("Make encoded %v %v anyway: %v", tt.op, tt.operands, instruction)
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestEveryOpcodeIsDefined(t *testing.T) {
+	for op := OpConstant; op <= OpClosure; op++ {
+		if _, err := Lookup(byte(op)); err != nil {
+			t.Errorf("opcode %d has no definition", op)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestDisassembleAnnotations(t *testing.T) {
+	ins := Instructions{}
+	ins = append(ins, Make(OpConstant, 0)...)
+	ins = append(ins, Make(OpPop)...)
+
+	got := ins.Disassemble(func(op Opcode, operands []int) string {
+		if op == OpConstant {
+			return "five"
+		}
+		return ""
+	})
+
+	expected := "0000 OpConstant 0             ; five\n0003 OpPop\n"
+	if got != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot =%q", expected, got)
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	ins := Instructions{255, byte(OpConstant), 0}
+
+	expected := "0000 ERROR: opcode 255 undefined\n0001 ERROR: OpConstant is missing operand bytes\n"
+	if ins.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot =%q", expected, ins.String())
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	table := LineTable{{Offset: 0, Line: 1}, {Offset: 4, Line: 3}, {Offset: 9, Line: 2}}
+
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 3},
+		{8, 3},
+		{9, 2},
+		{100, 2},
+	}
+
+	for _, tt := range tests {
+		if line := table.Line(tt.offset); line != tt.line {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.line, line)
+		}
+	}
+
+	if line := (LineTable{}).Line(0); line != 0 {
+		t.Errorf("empty table should not know any line, got=%d", line)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/mkc"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/printer"
+	"interpreter/repl"
+	"interpreter/token"
+	"interpreter/vm"
+	"os"
+	"strings"
+)
+
+// runCommand runs a program. Source files run on the virtual machine by default,
+// or on the evaluator with -engine eval; .mkc files always run on the virtual machine.
+func runCommand(c *cli, args []string) error {
+	flags := c.flagSet("run")
+	engine := flags.String("engine", "vm", "run source files on the `engine` vm or eval")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 {
+		return c.commandUsage("run")
+	}
+	if *engine != "vm" && *engine != "eval" {
+		fmt.Fprintf(c.stderr, "monkey run: unknown engine %q\n", *engine)
+		return errUsage
+	}
+
+	name, src, err := c.readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	object.Args = flags.Args()[1:]
+
+	if *engine == "eval" && !mkc.IsMkc(src) {
+		program, err := c.parse(name, src)
+		if err != nil {
+			return err
+		}
+		if program, err = c.expand(name, program); err != nil {
+			return err
+		}
+
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if errObj, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s: %s", name, errObj.Message)
+		}
+		return nil
+	}
+
+	bytecode, err := c.load(name, src)
+	if err != nil {
+		return err
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		var vmErr *vm.Error
+		if errors.As(err, &vmErr) && vmErr.Line > 0 {
+			return fmt.Errorf("%s:%d: %s", name, vmErr.Line, vmErr.Message)
+		}
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
+// replCommand starts an interactive session on the standard input.
+func replCommand(c *cli, args []string) error {
+	if len(args) != 0 {
+		return c.commandUsage("repl")
+	}
+
+	fmt.Fprintln(c.stdout, "This is the Monkey programming language!")
+	fmt.Fprintln(c.stdout, "Feel free to type in commands")
+	repl.Start(c.stdin, c.stdout)
+	return nil
+}
+
+// checkCommand reports the syntax errors of every file and fails if there were any.
+// Nothing is printed for files without errors.
+func checkCommand(c *cli, args []string) error {
+	if len(args) == 0 {
+		return c.commandUsage("check")
+	}
+
+	failed := 0
+	for _, path := range args {
+		name, src, err := c.readSource(path)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			failed++
+			continue
+		}
+
+		if _, err := c.parse(name, src); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) have errors", failed, len(args))
+	}
+	return nil
+}
+
+// tokensCommand prints every token of a source file on a line of its own:
+// its position, its type and its literal.
+func tokensCommand(c *cli, args []string) error {
+	if len(args) != 1 {
+		return c.commandUsage("tokens")
+	}
+
+	name, src, err := c.readSource(args[0])
+	if err != nil {
+		return err
+	}
+
+	l := lexer.New(string(src))
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(c.stdout, "%-8s %-9s %q\n", tok.Pos, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	return c.reportDiagnostics(name, src, l.Errors())
+}
+
+// parseCommand prints the syntax tree of a source file. The tree is printed even when there
+// are syntax errors, with the broken parts showing up as bad statements and expressions.
+// With -json the tree is printed in the lossless JSON encoding of ast.EncodeJSON instead.
+func parseCommand(c *cli, args []string) error {
+	flags := c.flagSet("parse")
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return c.commandUsage("parse")
+	}
+
+	name, src, err := c.readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if *asJSON {
+		err = c.printJSON(program)
+	} else {
+		err = ast.Fprint(c.stdout, program)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.reportDiagnostics(name, src, p.Errors())
+}
+
+// printJSON prints the JSON encoding of a syntax tree, indented for reading.
+func (c *cli) printJSON(program *ast.Program) error {
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+
+	_, err = out.WriteTo(c.stdout)
+	return err
+}
+
+// fmtCommand prints source files in the canonical format. With -w the files are rewritten
+// instead, and with -d the changes are printed as a unified diff. Files with syntax errors
+// are left alone, since the broken parts can't be printed back.
+func fmtCommand(c *cli, args []string) error {
+	flags := c.flagSet("fmt")
+	write := flags.Bool("w", false, "write the result back to the files instead of printing it")
+	diff := flags.Bool("d", false, "print the changes as a unified diff instead of the result")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return c.commandUsage("fmt")
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		if err := c.formatFile(path, *write, *diff); err != nil {
+			if !errors.Is(err, errReported) {
+				fmt.Fprintln(c.stderr, err)
+			}
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) could not be formatted", failed, flags.NArg())
+	}
+	return nil
+}
+
+// errReported is returned by formatFile when the problem has already been printed.
+var errReported = errors.New("reported")
+
+// formatFile formats a single file for fmtCommand.
+func (c *cli) formatFile(path string, write, diff bool) error {
+	if write && path == "-" {
+		return errors.New("monkey fmt: can't use -w with the standard input")
+	}
+
+	name, src, err := c.readSource(path)
+	if err != nil {
+		return err
+	}
+	program, err := c.parse(name, src)
+	if err != nil {
+		return errReported
+	}
+	formatted := printer.String(program)
+
+	if diff {
+		fmt.Fprint(c.stdout, unifiedDiff(name+".orig", name, string(src), formatted))
+	}
+	if write {
+		if formatted == string(src) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+	}
+	if !diff {
+		fmt.Fprint(c.stdout, formatted)
+	}
+	return nil
+}
+
+// buildCommand compiles a source file to a .mkc file.
+func buildCommand(c *cli, args []string) error {
+	flags := c.flagSet("build")
+	out := flags.String("o", "", "write the compiled program to `file` instead of <source>.mkc")
+	strip := flags.Bool("strip", false, "leave out the line tables used to report source lines of runtime errors")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return c.commandUsage("build")
+	}
+
+	name, src, err := c.readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	bytecode, err := c.compile(name, src)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		if name == "<stdin>" {
+			fmt.Fprintln(c.stderr, "monkey build: -o is required when reading the standard input")
+			return errUsage
+		}
+		*out = strings.TrimSuffix(name, ".mk") + ".mkc"
+	}
+
+	var buf bytes.Buffer
+	if err := mkc.Write(&buf, bytecode, !*strip); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0o644)
+}
+
+// disasmCommand prints the disassembled bytecode of a source or .mkc file.
+func disasmCommand(c *cli, args []string) error {
+	if len(args) != 1 {
+		return c.commandUsage("disasm")
+	}
+
+	name, src, err := c.readSource(args[0])
+	if err != nil {
+		return err
+	}
+	bytecode, err := c.load(name, src)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.stdout, bytecode.Disassemble())
+	return nil
+}
+
+// flagSet creates the flag set of a command. Parse errors are reported by commandUsage,
+// so the flag package only prints the message itself.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {}
+	return flags
+}
+
+// load decodes src if it's a .mkc file and compiles it as source code otherwise.
+func (c *cli) load(name string, src []byte) (*compiler.Bytecode, error) {
+	if !mkc.IsMkc(src) {
+		return c.compile(name, src)
+	}
+
+	bytecode, err := mkc.Read(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return bytecode, nil
+}
+
+// compile parses a source file, expands its macros and compiles it.
+func (c *cli) compile(name string, src []byte) (*compiler.Bytecode, error) {
+	program, err := c.parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	if program, err = c.expand(name, program); err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// parse parses a source file, reporting its syntax errors on stderr.
+func (c *cli) parse(name string, src []byte) (*ast.Program, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+
+	if err := c.reportDiagnostics(name, src, p.Errors()); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// expand runs the macro passes over a parsed program. Macros run on the evaluator whichever
+// engine runs the program, since they work on syntax trees.
+func (c *cli) expand(name string, program *ast.Program) (*ast.Program, error) {
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return expanded.(*ast.Program), nil
+}
+
+// reportDiagnostics renders diagnostics against the source on stderr and returns an error
+// summarizing them, or nil if there are none.
+func (c *cli) reportDiagnostics(name string, src []byte, diagnostics []*diagnostic.Diagnostic) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	diagnostic.FprintAll(c.stderr, name, string(src), diagnostics)
+	return fmt.Errorf("%s: %d syntax error(s)", name, len(diagnostics))
+}
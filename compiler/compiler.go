@@ -0,0 +1,765 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// EmittedInstruction remembers an instruction the compiler emitted and where,
+// so it can be inspected or taken back later.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of one function while it's being compiled.
+// The top level of the program is a scope of its own.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+// Compiler turns an AST into bytecode for the virtual machine.
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// line is the source line of the node being compiled, recorded in the line tables.
+	line int
+}
+
+// Bytecode is the result of a compilation: the instructions of the top level of the program
+// and the constants they refer to. Compiled functions are among the constants.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string       // The name of every global, indexed by its slot, for error messages.
+	Lines        code.LineTable // The source lines of Instructions. Compiled functions carry their own.
+}
+
+// New creates a compiler with an empty constant pool and a symbol table that knows the builtins.
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+	}
+}
+
+// NewWithState creates a compiler that continues where an earlier one left off.
+// The REPL uses it to keep globals and constants around between lines.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// SymbolTable returns the global symbol table, to be handed to NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Bytecode returns the instructions and constants compiled so far.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.globals().Names(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+	}
+}
+
+// infixOpcodes maps the operators that compile to a single instruction to that instruction.
+// && and || aren't in here since they short-circuit and need jumps.
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShl,
+	">>": code.OpShr,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+}
+
+// prefixOpcodes maps prefix operators to their instruction.
+var prefixOpcodes = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+// Compile compiles node and everything below it. The error messages match the ones
+// the evaluator produces for the same mistakes.
+func (c *Compiler) Compile(node ast.Node) error {
+	// Instructions are attributed to the line of the innermost node they were compiled from.
+	// Nodes that weren't parsed from source have no position and keep the line of their parent.
+	if node != nil {
+		if pos := node.Pos(); pos.IsValid() {
+			defer func(line int) { c.line = line }(c.line)
+			c.line = pos.Line
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		if _, err := c.emit(code.OpPop); err != nil {
+			return err
+		}
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// The value is compiled before the name is defined, so 'let x = x + 1' sees the old x
+		// just like in the evaluator. Functions refer to themselves through FunctionScope instead.
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunction(fn, node.Name.Value)
+		} else {
+			err = c.Compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			_, err = c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			_, err = c.emit(code.OpSetLocal, symbol.Index)
+		}
+		if err != nil {
+			return err
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if _, err := c.emit(code.OpReturnValue); err != nil {
+			return err
+		}
+
+	case *ast.BadStatement:
+		return fmt.Errorf("invalid statement at %s", node.Pos())
+
+	case *ast.BadExpression:
+		return fmt.Errorf("invalid expression at %s", node.Pos())
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// The evaluator looks names up when they're used, so a name that isn't bound yet
+			// may still be bound by a later top-level let. It gets a global slot, and reading
+			// the slot before anything was stored in it is a runtime error.
+			symbol = c.globals().Define(node.Value)
+		}
+		return c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value})
+
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+
+	case *ast.Boolean:
+		op := code.OpFalse
+		if node.Value {
+			op = code.OpTrue
+		}
+		if _, err := c.emit(op); err != nil {
+			return err
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := prefixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if _, err := c.emit(op); err != nil {
+			return err
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if _, err := c.emit(op); err != nil {
+			return err
+		}
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		if _, err := c.emit(code.OpArray, len(node.Elements)); err != nil {
+			return err
+		}
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		if _, err := c.emit(code.OpHash, len(node.Pairs)*2); err != nil {
+			return err
+		}
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		if _, err := c.emit(code.OpIndex); err != nil {
+			return err
+		}
+
+	case *ast.SliceExpression:
+		return c.compileSliceExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literal at %s: macros can only be defined by a top-level let statement", node.Pos())
+
+	case *ast.CallExpression:
+		// Quotes hold syntax trees, which only exist while macros are expanded before compilation.
+		if ident, ok := node.Function.(*ast.Identifier); ok && (ident.Value == "quote" || ident.Value == "unquote") {
+			return fmt.Errorf("%s at %s: quote and unquote can only be used in macros", ident.Value, node.Pos())
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if _, err := c.emit(code.OpCall, len(node.Arguments)); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileLogicalExpression compiles && and ||. The right operand is only evaluated when the left
+// one doesn't decide the result, and the result is always a boolean, as in the evaluator.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos, err := c.emit(code.OpJumpNotTruthy, 9999)
+	if err != nil {
+		return err
+	}
+
+	if node.Operator == "&&" {
+		// A truthy left operand leaves the decision to the right one.
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+		jumpPos, err := c.emit(code.OpJump, 9999)
+		if err != nil {
+			return err
+		}
+		if err := c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions())); err != nil {
+			return err
+		}
+		if _, err := c.emit(code.OpFalse); err != nil {
+			return err
+		}
+		return c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	// A truthy left operand decides the result of ||, a falsy one leaves it to the right one.
+	if _, err := c.emit(code.OpTrue); err != nil {
+		return err
+	}
+	jumpPos, err := c.emit(code.OpJump, 9999)
+	if err != nil {
+		return err
+	}
+	if err := c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions())); err != nil {
+		return err
+	}
+	if err := c.compileTruthiness(node.Right); err != nil {
+		return err
+	}
+	return c.changeOperand(jumpPos, len(c.currentInstructions()))
+}
+
+// compileTruthiness compiles node and turns its value into true or false.
+// Negating twice is the cheapest way to do that with the existing instructions.
+func (c *Compiler) compileTruthiness(node ast.Expression) error {
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+	if _, err := c.emit(code.OpBang); err != nil {
+		return err
+	}
+	_, err := c.emit(code.OpBang)
+	return err
+}
+
+// compileIfExpression compiles a conditional. Both branches leave exactly one value on the stack:
+// the value of their last expression statement, or null.
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Emit the jump with a bogus target and fix it up once we know where the consequence ends.
+	jumpNotTruthyPos, err := c.emit(code.OpJumpNotTruthy, 9999)
+	if err != nil {
+		return err
+	}
+
+	if err := c.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos, err := c.emit(code.OpJump, 9999)
+	if err != nil {
+		return err
+	}
+	if err := c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions())); err != nil {
+		return err
+	}
+
+	if node.Alternative == nil {
+		_, err = c.emit(code.OpNull)
+	} else {
+		err = c.compileBranch(node.Alternative)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.changeOperand(jumpPos, len(c.currentInstructions()))
+}
+
+// compileBranch compiles a branch of a conditional so it leaves its value on the stack.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+		return nil
+	}
+
+	// The block is empty or ends in a statement that doesn't produce a value.
+	_, err := c.emit(code.OpNull)
+	return err
+}
+
+// compileSliceExpression compiles 'left[low:high]'. Only the bounds that are present are pushed,
+// and the operand of OpSlice tells the virtual machine which ones those are.
+func (c *Compiler) compileSliceExpression(node *ast.SliceExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	flags := 0
+	if node.Low != nil {
+		if err := c.Compile(node.Low); err != nil {
+			return err
+		}
+		flags |= code.SliceLow
+	}
+	if node.High != nil {
+		if err := c.Compile(node.High); err != nil {
+			return err
+		}
+		flags |= code.SliceHigh
+	}
+
+	_, err := c.emit(code.OpSlice, flags)
+	return err
+}
+
+// compileFunction compiles a function literal into a CompiledFunction constant and emits
+// the instructions that turn it into a closure at runtime. name is the name the function is
+// bound to with let, or empty.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	c.symbolTable.Declare(letNames(node.Body)...)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// The value of the last expression statement is the implicit return value.
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		if _, err := c.emit(code.OpReturn); err != nil {
+			return err
+		}
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	localNames := c.symbolTable.Names()
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	// Push the captured variables in the enclosing scope, where they're still locals or free variables.
+	for _, s := range freeSymbols {
+		if err := c.captureSymbol(s); err != nil {
+			return err
+		}
+	}
+
+	freeNames := make([]string, len(freeSymbols))
+	for i, s := range freeSymbols {
+		freeNames[i] = s.Name
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		Source:        object.FunctionSource(node.Parameters, node.Body),
+		Lines:         lines,
+	}
+
+	index, err := c.addConstant(compiledFn)
+	if err != nil {
+		return err
+	}
+	_, err = c.emit(code.OpClosure, index, len(freeSymbols))
+	return err
+}
+
+// letNames returns the names bound by the let statements of a function body, including the ones
+// in conditionals, but not the ones of the functions defined in it, which have scopes of their own.
+func letNames(body *ast.BlockStatement) []string {
+	var names []string
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				names = append(names, node.Name.Value)
+			}
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// globals returns the symbol table of the top level of the program.
+func (c *Compiler) globals() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// loadSymbol emits the instruction that pushes the value of s.
+func (c *Compiler) loadSymbol(s Symbol) error {
+	var err error
+	switch s.Scope {
+	case GlobalScope:
+		_, err = c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		_, err = c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		_, err = c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		_, err = c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		_, err = c.emit(code.OpCurrentClosure)
+	}
+	return err
+}
+
+// captureSymbol emits the instruction that pushes s for a closure to capture. Locals and free
+// variables are captured by reference, so the closure sees a later let that rebinds them,
+// just like a function of the evaluator sees the changes to its environment.
+func (c *Compiler) captureSymbol(s Symbol) error {
+	var err error
+	switch s.Scope {
+	case LocalScope:
+		_, err = c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		_, err = c.emit(code.OpCaptureFree, s.Index)
+	default:
+		err = c.loadSymbol(s)
+	}
+	return err
+}
+
+// emitConstant adds obj to the constant pool and emits the instruction that pushes it.
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	_, err = c.emit(code.OpConstant, index)
+	return err
+}
+
+// addConstant adds obj to the constant pool and returns its index. It fails if the index
+// doesn't fit into the operand of OpConstant.
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) > code.MaxOperand(2) {
+		return 0, fmt.Errorf("too many constants%s: the limit is %d", c.at(), code.MaxOperand(2)+1)
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// operandLimits describes, for the opcodes whose operands can grow with the program,
+// what doesn't fit when an operand is too large, and the largest count that does.
+var operandLimits = map[code.Opcode]struct {
+	what  string
+	limit int
+}{
+	code.OpConstant:      {"too many constants", code.MaxOperand(2) + 1},
+	code.OpJump:          {"code too large to jump over", code.MaxOperand(2)},
+	code.OpJumpNotTruthy: {"code too large to jump over", code.MaxOperand(2)},
+	code.OpGetGlobal:     {"too many global bindings", code.MaxOperand(2) + 1},
+	code.OpSetGlobal:     {"too many global bindings", code.MaxOperand(2) + 1},
+	code.OpGetLocal:      {"too many local bindings in a function", code.MaxOperand(1) + 1},
+	code.OpSetLocal:      {"too many local bindings in a function", code.MaxOperand(1) + 1},
+	code.OpCaptureLocal:  {"too many local bindings in a function", code.MaxOperand(1) + 1},
+	code.OpGetFree:       {"too many free variables in a function", code.MaxOperand(1)},
+	code.OpCaptureFree:   {"too many free variables in a function", code.MaxOperand(1)},
+	code.OpClosure:       {"too many free variables in a function", code.MaxOperand(1)},
+	code.OpArray:         {"too many elements in an array literal", code.MaxOperand(2)},
+	code.OpHash:          {"too many pairs in a hash literal", code.MaxOperand(2) / 2},
+	code.OpCall:          {"too many arguments in a call", code.MaxOperand(1)},
+}
+
+// emit appends an instruction to the current scope and returns its position.
+// It fails if an operand doesn't fit into its width, rather than letting code.Make truncate it.
+func (c *Compiler) emit(op code.Opcode, operands ...int) (int, error) {
+	if err := c.checkOperands(op, operands...); err != nil {
+		return 0, err
+	}
+
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos, nil
+}
+
+// checkOperands returns a compile error if op can't be encoded with operands.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) error {
+	err := code.CheckOperands(op, operands...)
+	if err == nil {
+		return nil
+	}
+
+	if l, ok := operandLimits[op]; ok {
+		return fmt.Errorf("%s%s: the limit is %d", l.what, c.at(), l.limit)
+	}
+	return fmt.Errorf("cannot encode instruction%s: %s", c.at(), err)
+}
+
+// at returns " at line N" for the line being compiled, or nothing if it isn't known.
+func (c *Compiler) at() string {
+	if c.line == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" at line %d", c.line)
+}
+
+// addInstruction appends the encoded instruction ins and returns its position.
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.addLine(posNewInstruction)
+	return posNewInstruction
+}
+
+// addLine records that the instruction at pos belongs to the current line,
+// unless the instructions before it already do.
+func (c *Compiler) addLine(pos int) {
+	if c.line == 0 {
+		return
+	}
+
+	lines := c.scopes[c.scopeIndex].lines
+	if n := len(lines); n > 0 && lines[n-1].Line == c.line {
+		return
+	}
+	c.scopes[c.scopeIndex].lines = append(lines, code.LineEntry{Offset: pos, Line: c.line})
+}
+
+// setLastInstruction keeps track of the last two instructions emitted in the current scope.
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+// currentInstructions returns the instructions of the scope being compiled.
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// lastInstructionIs reports whether the last instruction of the current scope is op.
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+// removeLastPop takes back the last instruction, which has to be an OpPop.
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	c.scopes[c.scopeIndex].instructions = old[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// Drop the line entry that started at the removed instruction, if any.
+	lines := c.scopes[c.scopeIndex].lines
+	if n := len(lines); n > 0 && lines[n-1].Offset >= last.Position {
+		c.scopes[c.scopeIndex].lines = lines[:n-1]
+	}
+}
+
+// replaceInstruction overwrites the instruction at pos with newInstruction of the same length.
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand replaces the operand of the instruction at opPos, e.g. to fix up a jump target.
+func (c *Compiler) changeOperand(opPos int, operand int) error {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	if err := c.checkOperands(op, operand); err != nil {
+		return err
+	}
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+	return nil
+}
+
+// replaceLastPopWithReturn turns the final OpPop of a function body into an OpReturnValue.
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// enterScope starts compiling a new function, with its own instructions and symbol table.
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope finishes the current function and returns its instructions.
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
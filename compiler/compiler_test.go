@@ -0,0 +1,808 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "7 % 3 << 1",
+			expectedConstants: []interface{}{7, 3, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpShl),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The operands are compiled in source order, even for <.
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpBang),
+				// 0006
+				code.Make(code.OpBang),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpFalse),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 11),
+				// 0008
+				code.Make(code.OpFalse),
+				// 0009
+				code.Make(code.OpBang),
+				// 0010
+				code.Make(code.OpBang),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// A branch without a value leaves null on the stack.
+			input:             "if (true) { }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2; one;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The value is compiled before the name is rebound, so it reads the old x.
+			input:             "let x = 1; let x = x + 1;",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringArrayAndHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4}",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1][0]",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[][1:]",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSlice, code.SliceLow),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[][:2]",
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSlice, code.SliceHigh),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The last expression statement is the implicit return value.
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let oneArg = fn(a) { a }; oneArg(24);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "len([]); push([], 1);",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { len([]) }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let countDown = fn(x) { countDown(x - 1); }; countDown(1);",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestUnboundIdentifiers(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// g is bound after f refers to it, so it's resolved as a global.
+			input: "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	if err := compiler.Compile(parse("let a = 1; missing;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	names := compiler.Bytecode().GlobalNames
+	if len(names) != 2 || names[0] != "a" || names[1] != "missing" {
+		t.Errorf("wrong global names. got=%q", names)
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+  x +
+    a
+};
+f(2);`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expectedMain := code.LineTable{
+		{Offset: 0, Line: 1}, // OpConstant 1, OpSetGlobal a
+		{Offset: 6, Line: 2}, // OpClosure, OpSetGlobal f
+		{Offset: 13, Line: 6},
+	}
+	testLineTable(t, "main", expectedMain, bytecode.Lines)
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	expectedFn := code.LineTable{
+		{Offset: 0, Line: 3}, // OpGetLocal x
+		{Offset: 2, Line: 4}, // OpGetGlobal a
+		{Offset: 5, Line: 3}, // OpAdd, OpReturnValue
+	}
+	testLineTable(t, "fn", expectedFn, fn.Lines)
+}
+
+func testLineTable(t *testing.T, name string, expected, actual code.LineTable) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Errorf("%s: wrong line table. want=%v, got=%v", name, expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("%s: wrong line table. want=%v, got=%v", name, expected, actual)
+			return
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1;", "invalid statement at 1:1"},
+		{"let m = macro(x) { x };", "macro literal at 1:9: macros can only be defined by a top-level let statement"},
+		{"let q = quote(1 + 2);", "quote at 1:9: quote and unquote can only be used in macros"},
+		{"fn() { unquote(x) };", "unquote at 1:8: quote and unquote can only be used in macros"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compiler error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	// repeat joins n copies of item, with %d replaced by the number of the copy.
+	repeat := func(item, sep string, n int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = strings.ReplaceAll(item, "%d", strconv.Itoa(i))
+		}
+		return strings.Join(items, sep)
+	}
+	freeVariables := func(n int) string {
+		return "fn() { " + repeat("let a%d = 1;", " ", n) + " fn() { " + repeat("a%d", "; ", n) + " } }"
+	}
+
+	tests := []struct {
+		input    string
+		expected string // Empty if the input still compiles.
+	}{
+		{repeat("1", ";", 65536), ""},
+		{repeat("1", ";", 65537), "too many constants at line 1: the limit is 65536"},
+		{repeat("let g%d = true;", "", 65536), ""},
+		{repeat("let g%d = true;", "", 65537), "too many global bindings at line 1: the limit is 65536"},
+		{"fn() { " + repeat("let l%d = true;", "", 256) + " }", ""},
+		{"fn() { " + repeat("let l%d = true;", "", 257) + " }", "too many local bindings in a function at line 1: the limit is 256"},
+		{freeVariables(255), ""},
+		{freeVariables(256), "too many free variables in a function at line 1: the limit is 255"},
+		{"len(" + repeat("true", ",", 255) + ")", ""},
+		{"len(" + repeat("true", ",", 256) + ")", "too many arguments in a call at line 1: the limit is 255"},
+		{"[" + repeat("true", ",", 65535) + "]", ""},
+		{"[" + repeat("true", ",", 65536) + "]", "too many elements in an array literal at line 1: the limit is 65535"},
+		{"{" + repeat("true: true", ",", 32767) + "}", ""},
+		{"{" + repeat("true: true", ",", 32768) + "}", "too many pairs in a hash literal at line 1: the limit is 32767"},
+		// The consequence ends just before offset 65535, where the alternative's jump lands.
+		{"if (true) { " + repeat("true", ";", 32764) + " }", ""},
+		{"if (true) { " + repeat("true", ";", 32765) + " }", "code too large to jump over at line 1: the limit is 65535"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("unexpected compiler error for %.40q...: %s", tt.input, err)
+		case tt.expected != "" && err == nil:
+			t.Errorf("expected compiler error for %.40q...", tt.input)
+		case tt.expected != "" && err.Error() != tt.expected:
+			t.Errorf("wrong error for %.40q.... want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestChangeOperandChecksWidth(t *testing.T) {
+	c := New()
+	pos, err := c.emit(code.OpJump, 9999)
+	if err != nil {
+		t.Fatalf("emit failed: %s", err)
+	}
+
+	if err := c.changeOperand(pos, 65535); err != nil {
+		t.Errorf("jump to 65535 rejected: %s", err)
+	}
+	if err := c.changeOperand(pos, 65536); err == nil || err.Error() != "code too large to jump over: the limit is 65535" {
+		t.Errorf("wrong error for a jump to 65536: %v", err)
+	}
+
+	expected := code.Make(code.OpJump, 65535)
+	if !bytes.Equal(c.currentInstructions(), expected) {
+		t.Errorf("instruction changed by the rejected jump. want=%v, got=%v", expected, c.currentInstructions())
+	}
+}
+
+func TestNewWithStateKeepsGlobals(t *testing.T) {
+	first := New()
+	if err := first.Compile(parse("let a = 1;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	second := NewWithState(first.SymbolTable(), first.Bytecode().Constants)
+	if err := second.Compile(parse("a;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpPop),
+	})
+	if err := testInstructions([]code.Instructions{expected}, second.Bytecode().Instructions); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if !bytes.Equal(actual, concatted) {
+		return fmt.Errorf("wrong instructions.\nwant=%q\ngot =%q", concatted, actual)
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok {
+				return fmt.Errorf("constant %d - object is not Integer. got=%T (%+v)", i, actual[i], actual[i])
+			}
+			if integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong value. got=%d, want=%d", i, integer.Value, constant)
+			}
+
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok {
+				return fmt.Errorf("constant %d - object is not String. got=%T (%+v)", i, actual[i], actual[i])
+			}
+			if str.Value != constant {
+				return fmt.Errorf("constant %d - wrong value. got=%q, want=%q", i, str.Value, constant)
+			}
+
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
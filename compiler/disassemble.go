@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// Disassemble renders the bytecode as readable text: the instructions of the top level first,
+// then every compiled function they create, and the functions those create in turn.
+// Operands that refer to constants, globals or builtins are annotated with what they refer to.
+func (b *Bytecode) Disassemble() string {
+	var out bytes.Buffer
+
+	out.WriteString("main:\n")
+	out.WriteString(b.Instructions.Disassemble(b.annotate))
+
+	visited := map[int]bool{}
+	b.disassembleFunctions(&out, b.Instructions, visited)
+
+	return out.String()
+}
+
+// disassembleFunctions appends the disassembly of every function ins creates with OpClosure,
+// depth-first and each function only once.
+func (b *Bytecode) disassembleFunctions(out *bytes.Buffer, ins code.Instructions, visited map[int]bool) {
+	for _, index := range closureConstants(ins) {
+		if visited[index] || index >= len(b.Constants) {
+			continue
+		}
+		visited[index] = true
+
+		fn, ok := b.Constants[index].(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(out, "\n%s (constant %d, %s, %s):\n",
+			functionName(fn), index,
+			plural(fn.NumParameters, "parameter"), plural(fn.NumLocals, "local"))
+		out.WriteString(fn.Instructions.Disassemble(b.annotate))
+
+		b.disassembleFunctions(out, fn.Instructions, visited)
+	}
+}
+
+// closureConstants returns the constant indexes of the functions ins creates, in order.
+func closureConstants(ins code.Instructions) []int {
+	var indexes []int
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			i++
+			continue
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		if code.Opcode(ins[i]) == code.OpClosure {
+			indexes = append(indexes, operands[0])
+		}
+
+		i += 1 + read
+	}
+
+	return indexes
+}
+
+// annotate describes what the operand of an instruction refers to.
+func (b *Bytecode) annotate(op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant, code.OpClosure:
+		if operands[0] >= len(b.Constants) {
+			return "constant out of range"
+		}
+		switch constant := b.Constants[operands[0]].(type) {
+		case *object.String:
+			return fmt.Sprintf("%q", constant.Value)
+		case *object.CompiledFunction:
+			return functionName(constant)
+		default:
+			return constant.Inspect()
+		}
+
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] < len(b.GlobalNames) {
+			return b.GlobalNames[operands[0]]
+		}
+
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	}
+
+	return ""
+}
+
+// functionName returns how a compiled function is referred to in the disassembly.
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "fn <anonymous>"
+	}
+	return "fn " + fn.Name
+}
+
+// plural renders a count followed by a noun in the right number.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,47 @@
+package compiler
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	input := `let name = "monkey";
+let adder = fn(a) { fn(b) { a + b + len(name) } };
+adder(1)(2);`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `main:
+0000 OpConstant 0             ; "monkey"
+0003 OpSetGlobal 0            ; name
+0006 OpClosure 2 0            ; fn adder
+0010 OpSetGlobal 1            ; adder
+0013 OpGetGlobal 1            ; adder
+0016 OpConstant 3             ; 1
+0019 OpCall 1
+0021 OpConstant 4             ; 2
+0024 OpCall 1
+0026 OpPop
+
+fn adder (constant 2, 1 parameter, 1 local):
+0000 OpCaptureLocal 0
+0002 OpClosure 1 1            ; fn <anonymous>
+0006 OpReturnValue
+
+fn <anonymous> (constant 1, 1 parameter, 1 local):
+0000 OpGetFree 0
+0002 OpGetLocal 0
+0004 OpAdd
+0005 OpGetBuiltin 0           ; len
+0007 OpGetGlobal 0            ; name
+0010 OpCall 1
+0012 OpAdd
+0013 OpReturnValue
+`
+
+	got := compiler.Bytecode().Disassemble()
+	if got != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
@@ -0,0 +1,169 @@
+package compiler
+
+// SymbolScope tells the compiler where the value of a name lives at runtime.
+type SymbolScope string
+
+// Scopes a symbol can be defined in.
+const (
+	GlobalScope   SymbolScope = "GLOBAL"   // A let binding at the top level of the program.
+	LocalScope    SymbolScope = "LOCAL"    // A parameter or let binding inside a function.
+	BuiltinScope  SymbolScope = "BUILTIN"  // A function from object.Builtins.
+	FreeScope     SymbolScope = "FREE"     // A local of an enclosing function, captured by a closure.
+	FunctionScope SymbolScope = "FUNCTION" // The name of the function being compiled, used for recursion.
+)
+
+// Symbol is everything the compiler knows about a name: what it's called, where it lives
+// and its index within that scope.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps names to symbols. Every function gets its own table, enclosed by the table
+// of the code around it, so names resolve from the innermost function outwards.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// later holds the names a let statement of the function binds, see Declare. forward holds
+	// the slots reserved for them before they're bound, because a nested function refers to them.
+	later   map[string]bool
+	forward map[string]Symbol
+
+	// FreeSymbols are the symbols of enclosing functions this function refers to,
+	// in the order they have to be pushed when the closure is created.
+	FreeSymbols []Symbol
+}
+
+// NewSymbolTable creates a table for the top level of a program.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), later: make(map[string]bool), forward: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable creates a table for a function defined in the scope of outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this table. Names at the top level become globals and names inside
+// a function become locals. Defining a name again reuses its slot, so rebinding a name with let
+// doesn't make the table grow, and so does defining a name a nested function already refers to.
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := LocalScope
+	if s.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if existing, ok := s.store[name]; ok && existing.Scope == scope {
+		return existing
+	}
+	if reserved, ok := s.forward[name]; ok {
+		delete(s.forward, name)
+		s.store[name] = reserved
+		return reserved
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Declare records names that let statements of the function bind further on. The evaluator
+// looks names up when they're used, so a nested function sees such a binding once it's made,
+// even though the function was defined before it. Declare has no effect at the top level,
+// where names that aren't bound yet become globals anyway.
+func (s *SymbolTable) Declare(names ...string) {
+	for _, name := range names {
+		s.later[name] = true
+	}
+}
+
+// DefineBuiltin binds name to the builtin at index in object.Builtins.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled, so its body can call itself.
+// Any parameter or local with the same name takes precedence.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineFree records that original, a symbol of an enclosing function, is used by this function
+// and returns the symbol this function refers to it by.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks up name in this table and the tables enclosing it.
+// Locals of enclosing functions are turned into free variables on the way back in.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.resolveForNested(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	// Globals and builtins are reachable from anywhere, so they're used as they are.
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// resolveForNested resolves name on behalf of a function nested in this one. A name that isn't
+// bound yet, but will be by a let statement further on, gets its local slot right away,
+// so the nested function captures the variable the let statement stores into.
+func (s *SymbolTable) resolveForNested(name string) (Symbol, bool) {
+	if _, ok := s.store[name]; !ok && s.Outer != nil {
+		if reserved, ok := s.forward[name]; ok {
+			return reserved, true
+		}
+		if s.later[name] {
+			symbol := Symbol{Name: name, Scope: LocalScope, Index: s.numDefinitions}
+			s.forward[name] = symbol
+			s.numDefinitions++
+			return symbol, true
+		}
+	}
+
+	return s.Resolve(name)
+}
+
+// Names returns the names of the globals or locals defined in the table, indexed by their slot.
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = symbol.Name
+		}
+	}
+	for _, symbol := range s.forward {
+		names[symbol.Index] = symbol.Name
+	}
+	return names
+}
+
+// NumDefinitions returns how many globals or locals the table has defined.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
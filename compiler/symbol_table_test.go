@@ -0,0 +1,172 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestRedefineReusesSlot(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	if a := global.Define("a"); a.Index != 0 {
+		t.Errorf("redefined a has wrong index. want=0, got=%d", a.Index)
+	}
+	if global.NumDefinitions() != 2 {
+		t.Errorf("wrong number of definitions. want=2, got=%d", global.NumDefinitions())
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	tests := []struct {
+		table           *SymbolTable
+		expectedSymbols []Symbol
+		expectedFree    []Symbol
+	}{
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+			nil,
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "c", Scope: FreeScope, Index: 0},
+				{Name: "e", Scope: LocalScope, Index: 0},
+			},
+			[]Symbol{
+				{Name: "c", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.expectedFree) {
+			t.Errorf("wrong number of free symbols. got=%d, want=%d",
+				len(tt.table.FreeSymbols), len(tt.expectedFree))
+			continue
+		}
+		for i, sym := range tt.expectedFree {
+			if tt.table.FreeSymbols[i] != sym {
+				t.Errorf("wrong free symbol. got=%+v, want=%+v", tt.table.FreeSymbols[i], sym)
+			}
+		}
+	}
+}
+
+func TestResolveBuiltinsAndFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("fib")
+
+	if sym, _ := local.Resolve("len"); sym != (Symbol{Name: "len", Scope: BuiltinScope, Index: 0}) {
+		t.Errorf("len resolved to %+v", sym)
+	}
+	if sym, _ := local.Resolve("fib"); sym != (Symbol{Name: "fib", Scope: FunctionScope, Index: 0}) {
+		t.Errorf("fib resolved to %+v", sym)
+	}
+
+	// A parameter with the function's own name shadows it.
+	local.Define("fib")
+	if sym, _ := local.Resolve("fib"); sym != (Symbol{Name: "fib", Scope: LocalScope, Index: 0}) {
+		t.Errorf("shadowed fib resolved to %+v", sym)
+	}
+
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("builtins must not become free variables, got=%+v", local.FreeSymbols)
+	}
+}
+
+func TestResolveUnresolvable(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	if _, ok := local.Resolve("b"); ok {
+		t.Errorf("name b resolved, but was expected not to")
+	}
+}
+
+func TestResolveDeclaredLater(t *testing.T) {
+	global := NewSymbolTable()
+	global.Declare("g") // No effect at the top level.
+
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("a")
+	outer.Declare("y")
+	inner := NewEnclosedSymbolTable(outer)
+
+	if _, ok := inner.Resolve("g"); ok {
+		t.Errorf("g resolved, but only functions reserve names bound later")
+	}
+
+	// The nested function gets y as a free variable, for which the outer function reserves a slot.
+	if sym, _ := inner.Resolve("y"); sym != (Symbol{Name: "y", Scope: FreeScope, Index: 0}) {
+		t.Errorf("y resolved to %+v", sym)
+	}
+	if inner.FreeSymbols[0] != (Symbol{Name: "y", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong free symbol for y: %+v", inner.FreeSymbols[0])
+	}
+
+	// The outer function itself doesn't see y until it's bound, and then binds it in that slot.
+	if _, ok := outer.Resolve("y"); ok {
+		t.Errorf("y resolved in the outer function before it was defined")
+	}
+	if sym := outer.Define("y"); sym != (Symbol{Name: "y", Scope: LocalScope, Index: 1}) {
+		t.Errorf("y defined as %+v", sym)
+	}
+	if outer.NumDefinitions() != 2 || strings.Join(outer.Names(), ",") != "a,y" {
+		t.Errorf("wrong definitions: %d %q", outer.NumDefinitions(), outer.Names())
+	}
+}
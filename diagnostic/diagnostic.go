@@ -0,0 +1,154 @@
+package diagnostic
+
+import (
+	"fmt"
+	"interpreter/token"
+	"io"
+	"strings"
+)
+
+// Severity tells how serious a diagnostic is.
+type Severity int
+
+// Severities, from the most to the least serious.
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// String returns the lowercase name of the severity, as it's printed in front of a message.
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Codes that identify the kind of problem. They stay stable even if the wording of the message changes,
+// so tools can match on them instead of on the message.
+const (
+	UnexpectedToken   = "E0001" // a specific token was expected but a different one was found
+	MissingExpression = "E0002" // the token found cannot start an expression
+	InvalidIntegerLit = "E0003" // the digits of an integer literal don't fit into an int64
+
+	IllegalCharacter    = "E0100" // a character that doesn't start any token
+	UnterminatedString  = "E0101" // a string literal without its closing quote
+	InvalidEscape       = "E0102" // an unknown or malformed escape sequence in a string literal
+	InvalidUTF8         = "E0103" // bytes in the source that aren't valid UTF-8
+	UnterminatedComment = "E0104" // a block comment without its closing */
+)
+
+// Span is the range of source code a diagnostic points at. End is exclusive.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Diagnostic is a single problem found in the source code.
+// Expected and Found are set by the parser when the problem is an unexpected token.
+type Diagnostic struct {
+	Severity Severity
+	Span     Span
+	Code     string
+	Message  string
+	Expected []token.TokenType // The token types that would have been accepted, if known.
+	Found    token.Token       // The token that was found instead, if any.
+}
+
+// Error renders the diagnostic on a single line as "line:column: message".
+// It also makes *Diagnostic usable as an error value.
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// Fprint writes the diagnostic to w in the style of modern compilers:
+// a header with severity, code and message, the location, and the offending source line
+// with the span underlined by carets. name is the file name shown in the location; it may be empty.
+func Fprint(w io.Writer, name, src string, d *Diagnostic) {
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	location := d.Span.Start.String()
+	if name != "" {
+		location = name + ":" + location
+	}
+
+	// Without a valid position there is no source line to show.
+	if !d.Span.Start.IsValid() {
+		fmt.Fprintf(w, " --> %s\n", location)
+		return
+	}
+
+	line := sourceLine(src, d.Span.Start)
+	lineNo := fmt.Sprintf("%d", d.Span.Start.Line)
+	gutter := strings.Repeat(" ", len(lineNo))
+
+	fmt.Fprintf(w, "%s--> %s\n", gutter, location)
+	fmt.Fprintf(w, "%s |\n", gutter)
+	fmt.Fprintf(w, "%s | %s\n", lineNo, line)
+	fmt.Fprintf(w, "%s | %s\n", gutter, underline(line, d.Span))
+}
+
+// FprintAll writes every diagnostic in diagnostics to w with Fprint.
+func FprintAll(w io.Writer, name, src string, diagnostics []*Diagnostic) {
+	for _, d := range diagnostics {
+		Fprint(w, name, src, d)
+	}
+}
+
+// sourceLine returns the text of the line pos is on, without the newline.
+func sourceLine(src string, pos token.Position) string {
+	if pos.Offset < 0 || pos.Offset > len(src) {
+		return ""
+	}
+
+	start := strings.LastIndexByte(src[:pos.Offset], '\n') + 1
+
+	end := strings.IndexByte(src[start:], '\n')
+	if end < 0 {
+		return strings.TrimRight(src[start:], "\r")
+	}
+	return strings.TrimRight(src[start:start+end], "\r")
+}
+
+// underline builds the marker line that goes below line.
+// Columns count characters, so the line is handled as runes rather than bytes.
+// Tabs before the span are kept so the carets line up with the source however wide tabs are rendered.
+// A span that continues on the next lines is underlined up to the end of the first one,
+// and an empty span (e.g. at the end of the input) still gets a single caret.
+func underline(line string, span Span) string {
+	chars := []rune(line)
+
+	startCol := span.Start.Column - 1
+	if startCol > len(chars) {
+		startCol = len(chars)
+	}
+
+	endCol := len(chars)
+	if span.End.Line == span.Start.Line && span.End.Column-1 <= len(chars) {
+		endCol = span.End.Column - 1
+	}
+
+	width := endCol - startCol
+	if width < 1 {
+		width = 1
+	}
+
+	var out strings.Builder
+	for _, ch := range chars[:startCol] {
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
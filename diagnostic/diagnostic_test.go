@@ -0,0 +1,117 @@
+package diagnostic
+
+import (
+	"bytes"
+	"interpreter/token"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	src := "let a = 1;\n\tlet b = add(1 2);\n"
+
+	tests := []struct {
+		name     string
+		d        *Diagnostic
+		expected string
+	}{
+		{
+			"",
+			&Diagnostic{
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Message:  "expected next token to be ), got INT instead",
+				Span: Span{
+					Start: token.Position{Offset: 26, Line: 2, Column: 16},
+					End:   token.Position{Offset: 27, Line: 2, Column: 17},
+				},
+			},
+			"error[E0001]: expected next token to be ), got INT instead\n" +
+				" --> 2:16\n" +
+				"  |\n" +
+				"2 | \tlet b = add(1 2);\n" +
+				"  | \t              ^\n",
+		},
+		{
+			"main.mk",
+			&Diagnostic{
+				Severity: Warning,
+				Code:     "W0001",
+				Message:  "unused variable",
+				Span: Span{
+					Start: token.Position{Offset: 4, Line: 1, Column: 5},
+					End:   token.Position{Offset: 9, Line: 1, Column: 10},
+				},
+			},
+			"warning[W0001]: unused variable\n" +
+				" --> main.mk:1:5\n" +
+				"  |\n" +
+				"1 | let a = 1;\n" +
+				"  |     ^^^^^\n",
+		},
+		{
+			"",
+			&Diagnostic{
+				Severity: Error,
+				Code:     MissingExpression,
+				Message:  "no prefix parse function for EOF found",
+				Span: Span{
+					Start: token.Position{Offset: 30, Line: 3, Column: 1},
+					End:   token.Position{Offset: 30, Line: 3, Column: 1},
+				},
+			},
+			"error[E0002]: no prefix parse function for EOF found\n" +
+				" --> 3:1\n" +
+				"  |\n" +
+				"3 | \n" +
+				"  | ^\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		Fprint(&out, tt.name, src, tt.d)
+
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - output wrong.\nexpected=%q\ngot=%q", i, tt.expected, out.String())
+		}
+	}
+}
+
+func TestFprintUnicode(t *testing.T) {
+	src := "let größe = \"€\" + 1;"
+
+	d := &Diagnostic{
+		Severity: Error,
+		Code:     "E9999",
+		Message:  "type mismatch",
+		Span: Span{
+			Start: token.Position{Offset: 14, Line: 1, Column: 13},
+			End:   token.Position{Offset: 23, Line: 1, Column: 20},
+		},
+	}
+
+	expected := "error[E9999]: type mismatch\n" +
+		" --> 1:13\n" +
+		"  |\n" +
+		"1 | let größe = \"€\" + 1;\n" +
+		"  |             ^^^^^^^\n"
+
+	var out bytes.Buffer
+	Fprint(&out, "", src, d)
+
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestError(t *testing.T) {
+	d := &Diagnostic{
+		Message: "expected next token to be =, got INT instead",
+		Span:    Span{Start: token.Position{Offset: 6, Line: 1, Column: 7}},
+	}
+
+	expected := "1:7: expected next token to be =, got INT instead"
+	if d.Error() != expected {
+		t.Errorf("d.Error() wrong. expected=%q, got=%q", expected, d.Error())
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around every change.
+const diffContext = 3
+
+// edit is one line of an edit script turning one text into another.
+type edit struct {
+	kind byte   // ' ' for a line both texts have, '-' for a deleted line and '+' for an inserted one.
+	text string // The line, including its newline if it has one.
+}
+
+// unifiedDiff returns the changes between the texts a and b in the unified diff format,
+// or "" if they are equal.
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	// aLine and bLine count the lines of a and b before edits[i].
+	aLine, bLine := 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		// A hunk starts with the context before the change and grows while the next change is
+		// close enough for the contexts to touch.
+		start := max(0, i-diffContext)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(len(edits), end+diffContext)
+
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		aCount, bCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.kind != '+' {
+				aCount++
+			}
+			if e.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		aLine += aCount - (i - start)
+		bLine += bCount - (i - start)
+		i = end
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk. start is the number of lines before it,
+// which is also the line number of its first line minus one, except for an empty hunk:
+// those are numbered after the line they follow.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s after every newline. The last line has no newline if s doesn't end with one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a shortest edit script turning the lines a into the lines b, using the
+// greedy algorithm from Myers' "An O(ND) Difference Algorithm and Its Variations".
+// v[k] holds how far along a the furthest path on diagonal k (x - y = k) has come;
+// a copy of v is kept for every number of edits d, so the path can be traced back at the end.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1 // Diagonals range from -(n+m) to n+m.
+	v := make([]int, 2*offset+1)
+
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			// Step down from diagonal k+1 (an insertion) or right from k-1 (a deletion),
+			// whichever got further, then follow the lines the texts share.
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset)
+			}
+		}
+	}
+
+	panic("unreachable")
+}
+
+// backtrack follows the path found by diffLines from the end of both texts back to the start.
+func backtrack(a, b []string, trace [][]int, offset int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{' ', a[x]})
+	}
+
+	// The path was followed backwards.
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
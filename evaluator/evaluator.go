@@ -0,0 +1,641 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// There is only ever one true, one false and one null, so we reference these
+// instead of allocating new objects every time we need one.
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// Eval walks the AST and evaluates every node it is given in the environment env.
+// It returns the value the node produces; statements that don't produce a value return nil.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+
+	case *ast.InfixExpression:
+		// && and || only evaluate their right side when the left one doesn't decide the result
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *ast.MacroLiteral:
+		return newError("macro literal at %s: macros can only be defined by a top-level let statement", node.Pos())
+
+	case *ast.CallExpression:
+		// quote gets its argument unevaluated, so it can't be an ordinary function.
+		if isCallOf(node, "quote") {
+			return quote(node, env)
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	// Placeholders the parser inserted for code it couldn't understand
+	case *ast.BadStatement:
+		return newError("invalid statement at %s", node.Pos())
+
+	case *ast.BadExpression:
+		return newError("invalid expression at %s", node.Pos())
+	}
+
+	return nil
+}
+
+// evalProgram evaluates the statements of the program one after the other.
+// A return statement or an error stops the evaluation; the return value is unwrapped here,
+// because there is no outer scope left that needs to know a return happened.
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement evaluates the statements of a block.
+// Unlike evalProgram it does not unwrap return values: in nested blocks the ReturnValue
+// has to bubble up to the function call or program so the outer blocks stop as well.
+// A block that is empty or ends in a let statement produces null, so it's always safe to use as a value.
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// nativeBoolToBooleanObject maps a Go bool to the TRUE or FALSE singleton.
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// evalPrefixExpression applies a prefix operator to an already evaluated operand.
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// evalBangOperatorExpression negates the truthiness of right: only false and null are falsy.
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+// evalMinusPrefixOperatorExpression negates an integer.
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return newError("unknown operator: -%s", right.Type())
+	}
+
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
+}
+
+// evalTildePrefixOperatorExpression flips all bits of an integer.
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return newError("unknown operator: ~%s", right.Type())
+	}
+
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: ^value}
+}
+
+// evalLogicalExpression evaluates '&&' and '||' with short-circuiting: the right operand is
+// only evaluated when the left one doesn't already decide the result. The result is always a boolean.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// evalInfixExpression applies an infix operator to two already evaluated operands.
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	// Booleans and null are singletons, so comparing the pointers is enough.
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerInfixExpression applies an arithmetic or comparison operator to two integers.
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal << rightVal}
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalStringInfixExpression concatenates two strings with + or compares them with == and !=.
+// Strings are compared by value, unlike booleans which are compared by identity.
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIfExpression evaluates the consequence when the condition is truthy and the alternative otherwise.
+// Without an alternative a falsy condition produces null.
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// isTruthy reports whether obj counts as true in a condition: everything but false and null does.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// evalIdentifier looks up the value bound to the identifier.
+// Names bound in the environment shadow builtins, so 'let len = 1;' works as expected.
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := object.GetBuiltinByName(node.Value); ok {
+		return builtin
+	}
+
+	return newError("identifier not found: " + node.Value)
+}
+
+// evalExpressions evaluates a list of expressions from left to right.
+// If one of them produces an error, a slice holding only that error is returned.
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// evalIndexExpression looks up a single element of an array or character of a string.
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// evalArrayIndexExpression returns the element at index. Negative indexes count from the end,
+// so -1 is the last element. An index outside of the array produces null.
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+
+	i, ok := normalizeIndex(index.(*object.Integer).Value, len(elements))
+	if !ok {
+		return NULL
+	}
+
+	return elements[i]
+}
+
+// evalStringIndexExpression returns the character at index as a string of its own.
+// Strings are indexed by character, not by byte; negative indexes count from the end.
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+
+	i, ok := normalizeIndex(index.(*object.Integer).Value, len(chars))
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: string(chars[i])}
+}
+
+// evalHashIndexExpression looks up the value stored under index. A missing key produces null.
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+// evalHashLiteral evaluates the pairs of a hash literal in source order.
+// Every key must evaluate to a hashable value; a key that appears twice keeps the last value.
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+// normalizeIndex turns a possibly negative index into an offset into a sequence of length n
+// and reports whether it lies inside the sequence.
+func normalizeIndex(index int64, n int) (int, bool) {
+	if index < 0 {
+		index += int64(n)
+	}
+	if index < 0 || index >= int64(n) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// evalSliceExpression evaluates 'left[low:high]' on an array or a string.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len([]rune(left.Value))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := evalSliceBound(node.Low, env, 0, length)
+	if err != nil {
+		return err
+	}
+	high, err := evalSliceBound(node.High, env, length, length)
+	if err != nil {
+		return err
+	}
+	if high < low {
+		high = low
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return &object.Array{Elements: elements}
+	default:
+		chars := []rune(left.(*object.String).Value)
+		return &object.String{Value: string(chars[low:high])}
+	}
+}
+
+// evalSliceBound evaluates one bound of a slice, using def when it was left out.
+// Like an index a negative bound counts from the end, and bounds beyond either end are clamped,
+// so slicing never fails because of the bounds themselves.
+func evalSliceBound(exp ast.Expression, env *object.Environment, def, length int) (int, *object.Error) {
+	if exp == nil {
+		return def, nil
+	}
+
+	bound := Eval(exp, env)
+	if isError(bound) {
+		return 0, bound.(*object.Error)
+	}
+
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound must be INTEGER, got %s", bound.Type())
+	}
+
+	value := integer.Value
+	if value < 0 {
+		value += int64(length)
+	}
+	if value < 0 {
+		value = 0
+	}
+	if value > int64(length) {
+		value = int64(length)
+	}
+
+	return int(value), nil
+}
+
+// applyFunction calls fn with the given arguments.
+// The body is evaluated in a new environment enclosed by the function's own environment,
+// not by the caller's, which is what gives closures access to the variables they captured.
+// Builtins are called directly; a builtin without a result produces null.
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch function := fn.(type) {
+
+	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+		}
+
+		extendedEnv := extendFunctionEnv(function, args)
+		evaluated := Eval(function.Body, extendedEnv)
+		return unwrapReturnValue(evaluated)
+
+	case *object.Builtin:
+		if result := function.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+// extendFunctionEnv binds the arguments to the parameter names in a new enclosed environment.
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// unwrapReturnValue strips the ReturnValue wrapper so that a return inside a function
+// only stops that function and not the statements around the call.
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+// newError creates an Error object with a formatted message.
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// isError reports whether obj is an Error object.
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
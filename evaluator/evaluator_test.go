@@ -0,0 +1,741 @@
+package evaluator
+
+import (
+	"bytes"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-32 >> 2", -8},
+		{"1 + 6 & 3", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 0", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestShortCircuitEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// The right side would be an error if it were evaluated
+		{"false && missing", false},
+		{"true || missing", true},
+		{"let f = fn() { 1 / 0 }; 1 > 2 && f()", false},
+		{"let f = fn() { 1 / 0 }; 1 < 2 || f()", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"fn() { }()", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+		{`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`, 10},
+		{`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`, 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"10 / 0", "division by zero"},
+		{"5()", "not a function: INTEGER"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"1; let x 5; 2", "invalid statement at 1:4"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+		{"5 % 0", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"true & false", "unknown operator: BOOLEAN & BOOLEAN"},
+		{"true && missing", "identifier not found: missing"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+		{`[1, 2]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{"5[1:2]", "slice operator not supported: INTEGER"},
+		{"[1, 2][true:]", "slice bound must be INTEGER, got BOOLEAN"},
+		{"[1, missing]", "identifier not found: missing"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	input := `
+let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2);
+};
+fib(10);`
+
+	testIntegerObject(t, testEval(input), 55)
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!\t\u{263A}"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!\t☺" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `let greet = fn(name) { "Hello" + " " + name + "!" }; greet("World")`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"1" == 1`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-1]`, "o"},
+		{`"abc"[3]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{"let a = [1, 2, 3]; let n = 1; a[n:n + 1]", "[2]"},
+		{`"hello"[1:3]`, "el"},
+		{`"héllo"[:2]`, "hé"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[4:2]`, ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || isError(evaluated) {
+			t.Errorf("unexpected result for %q: %+v", tt.input, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSliceCopiesArray(t *testing.T) {
+	input := "let a = [1, 2, 3]; let b = a[:]; a;"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	Eval(program, env)
+
+	a, _ := env.Get("a")
+	b, _ := env.Get("b")
+	b.(*object.Array).Elements[0] = &object.Integer{Value: 99}
+
+	testIntegerObject(t, a.(*object.Array).Elements[0], 1)
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for i, tt := range expected {
+		if result.Keys[i] != tt.key.HashKey() {
+			t.Errorf("keys[%d] out of order. expected=%v, got=%v", i, tt.key.HashKey(), result.Keys[i])
+		}
+
+		pair, ok := result.Pairs[tt.key.HashKey()]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+
+		testIntegerObject(t, pair.Value, tt.value)
+	}
+
+	if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("result.Inspect() wrong. got=%q", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: want=1, got=2"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push([1])`, "wrong number of arguments: want=2, got=1"},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type([1])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`let len = fn(x) { 42 }; len([1])`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				testStringObject(t, evaluated, expected)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+	stdout := object.Stdout
+	object.Stdout = &out
+	defer func() { object.Stdout = stdout }()
+
+	evaluated := testEval(`puts("hello", 1, [true])`)
+	testNullObject(t, evaluated)
+
+	if out.String() != "hello\n1\n[true]\n" {
+		t.Errorf("puts wrote wrong output. got=%q", out.String())
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	object.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		if err := object.CheckArity(args, 1); err != nil {
+			return err
+		}
+		integer, ok := args[0].(*object.Integer)
+		if !ok {
+			return object.NewError("argument to `double` must be INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: integer.Value * 2}
+	})
+
+	testIntegerObject(t, testEval("double(21)"), 42)
+
+	evaluated := testEval(`double("a")`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "argument to `double` must be INTEGER, got STRING" {
+		t.Errorf("wrong result. got=%+v", evaluated)
+	}
+}
+
+func TestArrayFunctions(t *testing.T) {
+	input := `
+let map = fn(arr, f) {
+  let iter = fn(arr, accumulated) {
+    if (len(arr) == 0) {
+      accumulated
+    } else {
+      iter(rest(arr), push(accumulated, f(first(arr))));
+    }
+  };
+  iter(arr, []);
+};
+let reduce = fn(arr, initial, f) {
+  let iter = fn(arr, result) {
+    if (len(arr) == 0) {
+      result
+    } else {
+      iter(rest(arr), f(result, first(arr)));
+    }
+  };
+  iter(arr, initial);
+};
+let doubled = map([1, 2, 3, 4], fn(x) { x * 2 });
+reduce(doubled, 0, fn(acc, x) { acc + x });`
+
+	testIntegerObject(t, testEval(input), 20)
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
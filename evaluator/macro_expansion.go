@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// Macros are expanded in two passes between parsing and evaluation, or compilation:
+// DefineMacros takes the macro definitions out of the program, and ExpandMacros replaces
+// every call of a macro with the code the macro returns. Both work with a macro environment
+// of their own, so macros and the values of the program never see each other.
+
+// DefineMacros binds the macros defined by the top-level statements of program in env and
+// removes those statements. A macro is defined with 'let <name> = macro(<parameters>) { ... };'.
+// Macro literals anywhere else are left in the program, where they are an error.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			if macro, ok := let.Value.(*ast.MacroLiteral); ok {
+				env.Set(let.Name.Value, &object.Macro{Parameters: macro.Parameters, Body: macro.Body, Env: env})
+				continue
+			}
+		}
+		statements = append(statements, stmt)
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro bound in env with the code the macro returns.
+// The macro is called with the unevaluated arguments of the call, each wrapped in a quote,
+// and has to return a quote itself. Calls are expanded bottom-up, so the arguments of a call
+// are expanded before the call, but calls in the code a macro returns are not expanded.
+// The program is changed in place; the first macro that fails stops the expansion.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, name, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("macro %s at %s: wrong number of arguments: want=%d, got=%d",
+				name, call.Pos(), len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, extendMacroEnv(macro, quoteArgs(call))))
+		switch evaluated := evaluated.(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			err = fmt.Errorf("macro %s at %s: %s", name, call.Pos(), evaluated.Message)
+		default:
+			err = fmt.Errorf("macro %s at %s: a macro has to return a quote, got %s", name, call.Pos(), evaluated.Type())
+		}
+		return node
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// macroOf returns the macro a call calls and its name, if it calls an identifier bound to a macro in env.
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, string, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, "", false
+	}
+
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, "", false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ident.Value, ok
+}
+
+// quoteArgs wraps the arguments of a macro call in quotes.
+func quoteArgs(call *ast.CallExpression) []object.Object {
+	args := []object.Object{}
+
+	for _, a := range call.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+// extendMacroEnv binds the parameters of a macro to the quoted arguments in a new environment
+// enclosed by the macro environment.
+func extendMacroEnv(macro *object.Macro, args []object.Object) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
@@ -0,0 +1,186 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		// The arguments of a call are expanded before the call.
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2); };
+
+			double(double(1));
+			`,
+			`(1 * 2) * 2`,
+		},
+		// Macros are ordinary code while they run.
+		{
+			`
+			let repeat = macro(x) {
+				let twice = fn(e) { quote(unquote(e) + unquote(e)) };
+				twice(x);
+			};
+
+			repeat(a);
+			`,
+			`a + a`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros failed for %q: %s", tt.input, err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let m = macro(a) { quote(a) };\nm(1, 2);",
+			"macro m at 2:1: wrong number of arguments: want=1, got=2",
+		},
+		{
+			"let m = macro() { 1 };\nm();",
+			"macro m at 2:1: a macro has to return a quote, got INTEGER",
+		},
+		{
+			"let m = macro() { let x = 1; };\nm();",
+			"macro m at 2:1: a macro has to return a quote, got NULL",
+		},
+		{
+			"let m = macro() { missing };\nm();",
+			"macro m at 2:1: identifier not found: missing",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestMacroLiteralOutsideDefinition(t *testing.T) {
+	evaluated := testEval("let f = fn() { macro(x) { x } }; f();")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := "macro literal at 1:16: macros can only be defined by a top-level let statement"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. want=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+	"interpreter/token"
+	"strconv"
+)
+
+// quote returns the syntax tree of the argument of 'quote(<expression>)' without evaluating it.
+// Only the calls of unquote inside it are evaluated, and their values take their place.
+// quote and unquote aren't functions: their arguments have to reach them unevaluated,
+// so Eval recognizes their calls by name.
+func quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments: want=1, got=%d", len(call.Arguments))
+	}
+
+	node, err := evalUnquoteCalls(call.Arguments[0], env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls returns a copy of quoted in which every 'unquote(<expression>)' is replaced
+// by the syntax tree of the value of its argument. The original tree is left alone, so a quote
+// inside a function gives the same result every time the function is called.
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	node := ast.Modify(ast.Copy(quoted), func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallOf(call, "unquote") || err != nil {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments: want=1, got=%d", len(call.Arguments))
+			return node
+		}
+
+		value := Eval(call.Arguments[0], env)
+		if errObj, ok := value.(*object.Error); ok {
+			err = errObj
+			return node
+		}
+
+		replacement, convErr := convertObjectToASTNode(value, call)
+		if convErr != nil {
+			err = convErr
+			return node
+		}
+		return replacement
+	})
+
+	return node, err
+}
+
+// isCallOf reports whether call calls the identifier name.
+func isCallOf(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// convertObjectToASTNode turns the value of an unquoted expression back into code that
+// produces it. The new nodes get the position of the unquote call they replace,
+// so errors in the generated code point at it.
+func convertObjectToASTNode(obj object.Object, at ast.Node) (ast.Expression, *object.Error) {
+	tok := func(tokenType token.TokenType, literal string) token.Token {
+		return token.Token{Type: tokenType, Literal: literal, Pos: at.Pos(), End: at.End()}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: tok(token.INT, strconv.FormatInt(obj.Value, 10)), Value: obj.Value}, nil
+
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: tok(token.TRUE, "true"), Value: true}, nil
+		}
+		return &ast.Boolean{Token: tok(token.FALSE, "false"), Value: false}, nil
+
+	case *object.String:
+		return &ast.StringLiteral{Token: tok(token.STRING, obj.Value), Value: obj.Value}, nil
+
+	case *object.Quote:
+		// Quotes only ever hold the expression that was passed to quote.
+		return obj.Node.(ast.Expression), nil
+
+	default:
+		return nil, newError("cannot unquote a value of type %s", obj.Type())
+	}
+}
@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"interpreter/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(-5))`, `-5`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{
+			`let quotedInfixExpression = quote(4 + 4);
+			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+			`(8 + (4 + 4))`,
+		},
+		// The quoted code itself isn't changed, so every call gets its own value.
+		{
+			`let q = fn(x) { quote(unquote(x)) }; q(1); q(2)`,
+			`2`,
+		},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote()`, "wrong number of arguments: want=1, got=0"},
+		{`quote(1, 2)`, "wrong number of arguments: want=1, got=2"},
+		{`quote(unquote(1, 2))`, "wrong number of arguments: want=1, got=2"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`quote(unquote([1]))`, "cannot unquote a value of type ARRAY"},
+		{`unquote(1)`, "identifier not found: unquote"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, evaluated object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil")
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
@@ -1,19 +1,33 @@
 package lexer
 
-import "interpreter/token"
+import (
+	"fmt"
+	"interpreter/diagnostic"
+	"interpreter/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 // The Lexer struct holds the input string and information about the current position in that string.
+// The input is decoded as UTF-8, so a character is a rune that may span several bytes;
+// position and readPosition are byte offsets, while column counts characters.
 type Lexer struct {
 	input        string // the input string that we are going to analyze
 	position     int    // current position in the input string (points to the current character)
 	readPosition int    // the next reading position in the input string (one character ahead)
-	ch           byte   // the current character being analyzed
+	ch           rune   // the current character being analyzed
+	width        int    // the number of bytes the current character takes up in the input
+	line         int    // line of the current character, starting at 1
+	column       int    // column of the current character, starting at 1
+
+	errors []*diagnostic.Diagnostic // lexical errors, reported for every ILLEGAL token produced
 }
 
 // New creates a new Lexer instance and initializes it with the input string.
 func New(input string) *Lexer {
 	// Create a new Lexer and set the input string
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	// Read the first character to initialize the lexer
 	l.readChar()
 	return l
@@ -21,105 +35,328 @@ func New(input string) *Lexer {
 
 // readChar reads the next character in the input string and advances the lexer’s position.
 func (l *Lexer) readChar() {
+	// Keep track of the line and column of the character we're moving to.
+	// A newline ends the line, so the character after it starts a new one.
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	// Check if we've reached the end of the input string
 	if l.readPosition >= len(l.input) {
-		// If yes, set the current character to 0 (NUL), which signifies the end of the input
-		l.ch = 0
+		// If yes, set the current character to 0 (NUL); atEOF tells it apart from a NUL in the input
+		l.ch, l.width = 0, 1
 	} else {
-		// Otherwise, set the current character to the next one in the input string
-		l.ch = l.input[l.readPosition]
+		// Otherwise, decode the next character in the input string.
+		// A byte that isn't valid UTF-8 comes back as utf8.RuneError with a width of 1.
+		l.ch, l.width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	// Move the current position to the read position
 	l.position = l.readPosition
-	// Move the read position one step forward to prepare for the next character
-	l.readPosition += 1
+	// Move the read position past the current character to prepare for the next one
+	l.readPosition += l.width
+}
+
+// operators lists every operator and delimiter with the token type it stands for.
+// Longer operators come before the shorter ones they start with, so that matchOperator,
+// which takes the first entry that matches, finds '<<' before '<' and '==' before '='.
+var operators = []struct {
+	literal   string
+	tokenType token.TokenType
+}{
+	{"==", token.EQ},
+	{"!=", token.NOT_EQ},
+	{"<=", token.LT_EQ},
+	{">=", token.GT_EQ},
+	{"<<", token.SHL},
+	{">>", token.SHR},
+	{"&&", token.AND},
+	{"||", token.OR},
+
+	{"=", token.ASSIGN},
+	{"+", token.PLUS},
+	{"-", token.MINUS},
+	{"!", token.BANG},
+	{"*", token.ASTERISK},
+	{"/", token.SLASH},
+	{"%", token.PERCENT},
+	{"<", token.LT},
+	{">", token.GT},
+	{"&", token.AMPERSAND},
+	{"|", token.PIPE},
+	{"^", token.CARET},
+	{"~", token.TILDE},
+
+	{",", token.COMMA},
+	{";", token.SEMICOLON},
+	{":", token.COLON},
+	{"(", token.LPAREN},
+	{")", token.RPAREN},
+	{"{", token.LBRACE},
+	{"}", token.RBRACE},
+	{"[", token.LBRACKET},
+	{"]", token.RBRACKET},
+}
+
+// matchOperator looks for an operator or delimiter starting at the current character.
+func (l *Lexer) matchOperator() (token.TokenType, string, bool) {
+	rest := l.input[l.position:]
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op.literal) {
+			return op.tokenType, op.literal, true
+		}
+	}
+	return "", "", false
+}
+
+// invalidUTF8 reports whether the current character is a byte that isn't valid UTF-8,
+// as opposed to a correctly encoded U+FFFD replacement character.
+func (l *Lexer) invalidUTF8() bool {
+	return l.ch == utf8.RuneError && l.width == 1
 }
 
 // NextToken identifies and returns the next token (a meaningful element like a word, symbol, or number) from the input string.
+// Comments are not tokens: the ones before the token are attached to it as leading trivia,
+// and the ones following it on the same line as trailing trivia.
 func (l *Lexer) NextToken() token.Token {
+	// Skip any whitespace and collect the comments in between so we can focus on meaningful characters
+	leading := l.skipWhitespaceAndComments()
+
+	tok := l.readToken()
+
+	tok.Leading = leading
+	if tok.Type != token.EOF {
+		tok.Trailing = l.readTrailingComments()
+	}
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	// Skip any whitespace (like spaces or tabs) so we can focus on meaningful characters
-	l.skipWhitespace()
+	// Remember where the token starts, before we consume any of its characters
+	start := l.currentPosition()
 
-	// Check what the current character is and decide what type of token it represents
-	switch l.ch {
-	case '=':
-		// Handle '==' as a comparison operator
-		if l.peekChar() == '=' {
-			ch := l.ch
+	// Operators and delimiters are looked up in a table, longest match first
+	if tokenType, literal, ok := l.matchOperator(); ok {
+		// Operators are all ASCII, so every byte of the literal is one character
+		for range literal {
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
-		} else {
-			// Handle '=' as an assignment operator
-			tok = newToken(token.ASSIGN, l.ch)
 		}
-	case '+':
-		tok = newToken(token.PLUS, l.ch) // Handle the '+' operator
-	case '-':
-		tok = newToken(token.MINUS, l.ch) // Handle the '-' operator
-	case '!':
-		// Handle '!=' as a "not equal" operator
-		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
-		} else {
-			// Handle '!' as a "bang" operator (logical NOT)
-			tok = newToken(token.BANG, l.ch)
+		return token.Token{Type: tokenType, Literal: literal, Pos: start, End: l.currentPosition()}
+	}
+
+	// The end of the input is where the bytes run out. A NUL character before that is
+	// just an illegal character, so it can't silently cut the program short.
+	if l.atEOF() {
+		// There is nothing left to consume, so the token is empty and we don't advance
+		return token.Token{Type: token.EOF, Literal: "", Pos: start, End: start}
+	}
+
+	// Check what the current character is and decide what type of token it represents
+	switch l.ch {
+	case '"':
+		// Handle a string literal; the literal of the token is its decoded content
+		tok.Type, tok.Literal = l.readString(start)
+		if tok.Type == token.ILLEGAL {
+			// There is no meaningful content, so keep the source text for error messages
+			tok.Literal = l.input[start.Offset:l.position]
 		}
-	case '/':
-		tok = newToken(token.SLASH, l.ch) // Handle the '/' operator
-	case '*':
-		tok = newToken(token.ASTERISK, l.ch) // Handle the '*' operator
-	case '<':
-		tok = newToken(token.LT, l.ch) // Handle the '<' (less than) operator
-	case '>':
-		tok = newToken(token.GT, l.ch) // Handle the '>' (greater than) operator
-	case ';':
-		tok = newToken(token.SEMICOLON, l.ch) // Handle the ';' (semicolon)
-	case ',':
-		tok = newToken(token.COMMA, l.ch) // Handle the ',' (comma)
-	case '{':
-		tok = newToken(token.LBRACE, l.ch) // Handle the '{' (left brace)
-	case '}':
-		tok = newToken(token.RBRACE, l.ch) // Handle the '}' (right brace)
-	case '(':
-		tok = newToken(token.LPAREN, l.ch) // Handle the '(' (left parenthesis)
-	case ')':
-		tok = newToken(token.RPAREN, l.ch) // Handle the ')' (right parenthesis)
-	case 0:
-		// If we've reached the end of the input, return an EOF (End Of File) token
-		tok.Literal = ""
-		tok.Type = token.EOF
+		tok.Pos, tok.End = start, l.currentPosition()
+		return tok
 	default:
 		// Handle identifiers (like variable names) or numbers
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()          // Read the full identifier
 			tok.Type = token.LookupIdent(tok.Literal) // Determine the type of identifier
+			tok.Pos, tok.End = start, l.currentPosition()
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT         // Set the type to an integer
 			tok.Literal = l.readNumber() // Read the full number
+			tok.Pos, tok.End = start, l.currentPosition()
 			return tok
+		} else if l.invalidUTF8() {
+			// Keep the raw byte as the literal, since it doesn't decode to a character
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
+			l.addError(start, l.nextPosition(), diagnostic.InvalidUTF8, "invalid UTF-8 encoding (byte %#02x)", l.input[l.position])
 		} else {
 			// If the character is unrecognized, mark it as an illegal token
 			tok = newToken(token.ILLEGAL, l.ch)
+			l.addError(start, l.nextPosition(), diagnostic.IllegalCharacter, "illegal character %q", l.ch)
 		}
 	}
 
 	// Move to the next character for further analysis
 	l.readChar()
+	tok.Pos, tok.End = start, l.currentPosition()
 	return tok
 }
 
-// readIdentifier reads an identifier (like a variable name) until a non-letter character is found.
+// currentPosition returns the position of the character the lexer is currently looking at.
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// Errors returns the lexical errors found so far.
+// Every ILLEGAL token the lexer produces comes with at least one error in this list.
+func (l *Lexer) Errors() []*diagnostic.Diagnostic {
+	return l.errors
+}
+
+// addError records a lexical error spanning the source from start to end.
+func (l *Lexer) addError(start, end token.Position, code string, format string, a ...interface{}) {
+	l.errors = append(l.errors, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     diagnostic.Span{Start: start, End: end},
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// readString reads a double-quoted string literal starting at the opening quote and
+// returns its decoded content, with the escape sequences \n, \t, \", \\ and \u{...} resolved.
+// A string with a malformed escape sequence or without a closing quote is returned as ILLEGAL.
+func (l *Lexer) readString(start token.Position) (token.TokenType, string) {
+	var out strings.Builder
+	tokenType := token.TokenType(token.STRING)
+
+	for {
+		// Move past the opening quote or the character we just handled
+		l.readChar()
+
+		switch {
+		case l.ch == '"':
+			// Move past the closing quote
+			l.readChar()
+			return tokenType, out.String()
+		case l.atEOF():
+			l.addError(start, l.currentPosition(), diagnostic.UnterminatedString, "unterminated string literal")
+			return token.ILLEGAL, out.String()
+		case l.ch == '\\':
+			if !l.readEscape(&out) {
+				tokenType = token.ILLEGAL
+			}
+		case l.invalidUTF8():
+			l.addError(l.currentPosition(), l.nextPosition(), diagnostic.InvalidUTF8,
+				"invalid UTF-8 encoding (byte %#02x) in string literal", l.input[l.position])
+			tokenType = token.ILLEGAL
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// readEscape decodes the escape sequence starting at the backslash under the cursor and writes
+// the result to out. It leaves the lexer on the last character of the sequence and reports
+// whether the sequence was valid; invalid ones are recorded as errors and skipped.
+func (l *Lexer) readEscape(out *strings.Builder) bool {
+	start := l.currentPosition()
+
+	switch l.peekChar() {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		l.readChar()
+		return l.readUnicodeEscape(start, out)
+	default:
+		// A backslash at the very end of the input: readString reports the missing quote
+		if l.readPosition >= len(l.input) {
+			return false
+		}
+		l.readChar()
+		l.addError(start, l.nextPosition(), diagnostic.InvalidEscape, "unknown escape sequence \\%c", l.ch)
+		return false
+	}
+
+	l.readChar()
+	return true
+}
+
+// readUnicodeEscape decodes the '{XXXX}' part of a \u{XXXX} escape sequence with the cursor on the 'u'.
+// Between the braces there must be one to six hex digits naming a valid Unicode code point.
+func (l *Lexer) readUnicodeEscape(start token.Position, out *strings.Builder) bool {
+	if l.peekChar() != '{' {
+		l.addError(start, l.nextPosition(), diagnostic.InvalidEscape, "expected { after \\u")
+		return false
+	}
+	l.readChar()
+
+	digits := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	// Hex digits are all ASCII, so the bytes in between are exactly the digits
+	hex := l.input[digits:l.readPosition]
+
+	if l.peekChar() != '}' {
+		l.addError(start, l.nextPosition(), diagnostic.InvalidEscape, "expected } to close \\u{ escape sequence")
+		return false
+	}
+	l.readChar()
+	end := l.nextPosition()
+
+	if len(hex) == 0 || len(hex) > 6 {
+		l.addError(start, end, diagnostic.InvalidEscape, "\\u{} escape needs one to six hex digits")
+		return false
+	}
+
+	var code rune
+	for i := 0; i < len(hex); i++ {
+		code = code*16 + rune(hexValue(rune(hex[i])))
+	}
+	if !utf8.ValidRune(code) {
+		l.addError(start, end, diagnostic.InvalidEscape, "\\u{%s} is not a valid Unicode code point", hex)
+		return false
+	}
+
+	out.WriteRune(code)
+	return true
+}
+
+// nextPosition returns the position right after the current character, which is where
+// a span that ends with the current character ends.
+func (l *Lexer) nextPosition() token.Position {
+	pos := l.currentPosition()
+	if l.ch == '\n' {
+		return token.Position{Offset: pos.Offset + 1, Line: pos.Line + 1, Column: 1}
+	}
+	pos.Offset += l.width
+	pos.Column++
+	return pos
+}
+
+// isHexDigit checks if a character is a hexadecimal digit (0-9, a-f or A-F).
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// hexValue returns the numeric value of a hexadecimal digit.
+func hexValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	default:
+		return int(ch-'A') + 10
+	}
+}
+
+// readIdentifier reads an identifier (like a variable name) until a character is found
+// that is neither a letter nor a digit. The first character has already been checked to be a letter.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	// Continue reading characters as long as they are letters
-	for isLetter(l.ch) {
+	// Continue reading characters as long as they are letters or digits
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 	// Return the full identifier
@@ -127,13 +364,13 @@ func (l *Lexer) readIdentifier() string {
 }
 
 // newToken creates a new token with the specified type and character value.
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-// isLetter checks if a character is a letter (a-z, A-Z, or '_').
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter checks if a character is a letter in any script (as defined by unicode.IsLetter) or '_'.
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
 // skipWhitespace skips over any spaces, tabs, or newlines in the input string.
@@ -143,6 +380,86 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipWhitespaceAndComments skips whitespace and comments up to the next token
+// and returns the comments it skipped.
+func (l *Lexer) skipWhitespaceAndComments() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+		if !l.atComment() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// readTrailingComments reads the comments that follow the token just read on the same line.
+// It stops at the end of the line, so comments on the following lines lead the next token instead.
+func (l *Lexer) readTrailingComments() []token.Comment {
+	var comments []token.Comment
+	line := l.line
+
+	for {
+		for l.ch == ' ' || l.ch == '\t' {
+			l.readChar()
+		}
+		if !l.atComment() || l.line != line {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// atComment reports whether a comment starts at the current character.
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads the comment starting at the current character.
+// A line comment ends before the newline; block comments can be nested, so
+// '/* a /* b */ c */' is a single comment. A block comment that isn't closed runs to the end of the input.
+func (l *Lexer) readComment() token.Comment {
+	start := l.currentPosition()
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+	} else {
+		// Move past the opening '/*'
+		l.readChar()
+		l.readChar()
+
+		depth := 1
+		for depth > 0 {
+			switch {
+			case l.atEOF():
+				l.addError(start, l.currentPosition(), diagnostic.UnterminatedComment, "unterminated block comment")
+				depth = 0
+			case l.ch == '/' && l.peekChar() == '*':
+				depth++
+				l.readChar()
+				l.readChar()
+			case l.ch == '*' && l.peekChar() == '/':
+				depth--
+				l.readChar()
+				l.readChar()
+			default:
+				l.readChar()
+			}
+		}
+	}
+
+	end := l.currentPosition()
+	return token.Comment{Text: l.input[start.Offset:end.Offset], Pos: start, End: end}
+}
+
+// atEOF reports whether the lexer has read the whole input.
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
+}
+
 // readNumber reads a number (a sequence of digits) until a non-digit character is found.
 func (l *Lexer) readNumber() string {
 	position := l.position
@@ -155,17 +472,19 @@ func (l *Lexer) readNumber() string {
 }
 
 // isDigit checks if a character is a digit (0-9).
-func isDigit(ch byte) bool {
+// Only ASCII digits make up integer literals; other Unicode digits may only appear in identifiers.
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
 // peekChar allows us to look at the next character in the input string without moving the current position.
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	// Check if we've reached the end of the input string
 	if l.readPosition >= len(l.input) {
 		return 0 // Return 0 (NUL) if at the end
 	} else {
-		// Return the next character in the input string
-		return l.input[l.readPosition]
+		// Decode and return the next character in the input string
+		r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return r
 	}
 }
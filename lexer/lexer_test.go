@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"interpreter/token"
+	"strings"
 	"testing"
 )
 
@@ -14,7 +15,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -25,6 +26,11 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+"foobar"
+"foo bar"
+"tab\tnew\nline \"quoted\" back\\slash \u{1F600}\u{e9}"
+[1, 2][0:1];
+macro(x, y) { x + y; };
 `
 
 	tests := []struct {
@@ -104,6 +110,33 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "tab\tnew\nline \"quoted\" back\\slash \U0001F600é"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -123,3 +156,334 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == 5"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.SEMICOLON, token.Position{Offset: 10, Line: 1, Column: 11}, token.Position{Offset: 11, Line: 1, Column: 12}},
+		{token.IDENT, token.Position{Offset: 14, Line: 2, Column: 3}, token.Position{Offset: 15, Line: 2, Column: 4}},
+		{token.EQ, token.Position{Offset: 16, Line: 2, Column: 5}, token.Position{Offset: 18, Line: 2, Column: 7}},
+		{token.INT, token.Position{Offset: 19, Line: 2, Column: 8}, token.Position{Offset: 20, Line: 2, Column: 9}},
+		{token.EOF, token.Position{Offset: 20, Line: 2, Column: 9}, token.Position{Offset: 20, Line: 2, Column: 9}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedErrors  []string
+	}{
+		{`@`, "@", []string{"1:1: illegal character '@'"}},
+		{"\x00", "\x00", []string{"1:1: illegal character '\\x00'"}},
+		{`"abc`, `"abc`, []string{"1:1: unterminated string literal"}},
+		{`"abc\`, `"abc\`, []string{"1:1: unterminated string literal"}},
+		{`"a\qb"`, `"a\qb"`, []string{"1:3: unknown escape sequence \\q"}},
+		{`"\u00e9"`, `"\u00e9"`, []string{"1:2: expected { after \\u"}},
+		{`"\u{e9"`, `"\u{e9"`, []string{"1:2: expected } to close \\u{ escape sequence"}},
+		{`"\u{}"`, `"\u{}"`, []string{"1:2: \\u{} escape needs one to six hex digits"}},
+		{`"\u{d800}"`, `"\u{d800}"`, []string{"1:2: \\u{d800} is not a valid Unicode code point"}},
+		{`"\x \y"`, `"\x \y"`, []string{"1:2: unknown escape sequence \\x", "1:5: unknown escape sequence \\y"}},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.ILLEGAL, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after the illegal token, got=%q", i, next.Type)
+		}
+
+		errors := l.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Fatalf("tests[%d] - wrong number of errors. expected=%d, got=%d", i, len(tt.expectedErrors), len(errors))
+		}
+		for j, msg := range tt.expectedErrors {
+			if errors[j].Error() != msg {
+				t.Errorf("tests[%d] - errors[%d] wrong. expected=%q, got=%q", i, j, msg, errors[j].Error())
+			}
+		}
+	}
+}
+
+func TestNULDoesNotEndInput(t *testing.T) {
+	l := New("puts(1);\x00puts(2);")
+
+	var types []string
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, string(tok.Type))
+	}
+
+	expected := "IDENT ( INT ) ; ILLEGAL IDENT ( INT ) ;"
+	if actual := strings.Join(types, " "); actual != expected {
+		t.Errorf("wrong tokens. want=%q, got=%q", expected, actual)
+	}
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "1:9: illegal character '\\x00'" {
+		t.Errorf("wrong errors: %q", l.Errors())
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let größe = 10;\nlet 名前 = \"José 😀\";\nlet x2 = größe;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.LET, "let", "1:1"},
+		{token.IDENT, "größe", "1:5"},
+		{token.ASSIGN, "=", "1:11"},
+		{token.INT, "10", "1:13"},
+		{token.SEMICOLON, ";", "1:15"},
+		{token.LET, "let", "2:1"},
+		{token.IDENT, "名前", "2:5"},
+		{token.ASSIGN, "=", "2:8"},
+		{token.STRING, "José 😀", "2:10"},
+		{token.SEMICOLON, ";", "2:18"},
+		{token.LET, "let", "3:1"},
+		{token.IDENT, "x2", "3:5"},
+		{token.ASSIGN, "=", "3:8"},
+		{token.IDENT, "größe", "3:10"},
+		{token.SEMICOLON, ";", "3:15"},
+		{token.EOF, "", "3:16"},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+		if got := input[tok.Pos.Offset:tok.End.Offset]; tok.Type == token.IDENT && got != tt.expectedLiteral {
+			t.Errorf("tests[%d] - span wrong. expected=%q, got=%q", i, tt.expectedLiteral, got)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %q", l.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "let a\xff = \"b\xfe\";"
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "\xff"},
+		{token.ASSIGN, "="},
+		{token.ILLEGAL, "\"b\xfe\""},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expectedErrors := []string{
+		"1:6: invalid UTF-8 encoding (byte 0xff)",
+		"1:12: invalid UTF-8 encoding (byte 0xfe) in string literal",
+	}
+
+	errors := l.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d", len(expectedErrors), len(errors))
+	}
+	for i, msg := range expectedErrors {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+/* block
+   comment */ let x = 5; // trailing comment
+let y /* inside */ = x / 2; /* a /* nested */ comment */ /* second */
+// comment at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedLeading  []string
+		expectedTrailing []string
+	}{
+		{token.LET, "let", []string{"// leading comment", "/* block\n   comment */"}, nil},
+		{token.IDENT, "x", nil, nil},
+		{token.ASSIGN, "=", nil, nil},
+		{token.INT, "5", nil, nil},
+		{token.SEMICOLON, ";", nil, []string{"// trailing comment"}},
+		{token.LET, "let", nil, nil},
+		{token.IDENT, "y", nil, []string{"/* inside */"}},
+		{token.ASSIGN, "=", nil, nil},
+		{token.IDENT, "x", nil, nil},
+		{token.SLASH, "/", nil, nil},
+		{token.INT, "2", nil, nil},
+		{token.SEMICOLON, ";", nil, []string{"/* a /* nested */ comment */", "/* second */"}},
+		{token.EOF, "", []string{"// comment at the end"}, nil},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		testComments(t, i, "leading", tok.Leading, tt.expectedLeading)
+		testComments(t, i, "trailing", tok.Trailing, tt.expectedTrailing)
+
+		for _, c := range append(tok.Leading, tok.Trailing...) {
+			if input[c.Pos.Offset:c.End.Offset] != c.Text {
+				t.Errorf("tests[%d] - comment span wrong. expected=%q, got=%q", i, c.Text, input[c.Pos.Offset:c.End.Offset])
+			}
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %q", l.Errors())
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("1 /* open /* nested */")
+
+	if tok := l.NextToken(); tok.Type != token.INT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.INT, tok.Type)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Error() != "1:3: unterminated block comment" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+func testComments(t *testing.T, i int, kind string, comments []token.Comment, expected []string) {
+	if len(comments) != len(expected) {
+		t.Errorf("tests[%d] - wrong number of %s comments. expected=%d, got=%d", i, kind, len(expected), len(comments))
+		return
+	}
+	for j, text := range expected {
+		if comments[j].Text != text {
+			t.Errorf("tests[%d] - %s comment %d wrong. expected=%q, got=%q", i, kind, j, text, comments[j].Text)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a <= b >= c && d || e % f & g | h ^ ~i << j >> k <<= !== &&& |||`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "g"},
+		{token.PIPE, "|"},
+		{token.IDENT, "h"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "i"},
+		{token.SHL, "<<"},
+		{token.IDENT, "j"},
+		{token.SHR, ">>"},
+		{token.IDENT, "k"},
+		{token.SHL, "<<"},
+		{token.ASSIGN, "="},
+		{token.NOT_EQ, "!="},
+		{token.ASSIGN, "="},
+		{token.AND, "&&"},
+		{token.AMPERSAND, "&"},
+		{token.OR, "||"},
+		{token.PIPE, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if input[tok.Pos.Offset:tok.End.Offset] != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - span wrong. got=%q", i, input[tok.Pos.Offset:tok.End.Offset])
+		}
+	}
+}
@@ -1,19 +1,132 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"interpreter/repl"
+	"interpreter/object"
+	"io"
 	"os"
-	"os/user"
+	"strings"
 )
 
+// errUsage is returned by a command whose arguments are wrong. It has already printed its usage.
+var errUsage = errors.New("usage")
+
+// command is a subcommand of the monkey binary.
+type command struct {
+	name    string
+	args    string // The arguments, for the usage message.
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+// commands lists the subcommands in the order they're shown in the usage message.
+// It's filled in by init, since the help command refers back to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "[-engine vm|eval] <file> [args...]", "run a source or .mkc file; the program sees args through args()", runCommand},
+		{"repl", "", "start an interactive session (the default without a command)", replCommand},
+		{"check", "<file>...", "report syntax errors without running anything", checkCommand},
+		{"tokens", "<file>", "print the tokens of a source file", tokensCommand},
+		{"parse", "[-json] <file>", "print the syntax tree of a source file, or its JSON encoding with -json", parseCommand},
+		{"fmt", "[-w] [-d] <file>...", "print source files in the canonical format; -w rewrites them, -d shows the changes", fmtCommand},
+		{"build", "[-o file] [-strip] <file>", "compile a source file to a .mkc file", buildCommand},
+		{"disasm", "<file>", "print the bytecode of a source or .mkc file", disasmCommand},
+		{"help", "", "show this message", helpCommand},
+	}
+}
+
+// cli holds what the commands read from and write to, so they can be run from tests.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
-		user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status: 0 on success,
+// 1 if the command failed and 2 if it was used wrongly.
+// Wherever a command takes a file, "-" stands for the standard input.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	previousStdout, previousArgs := object.Stdout, object.Args
+	object.Stdout, object.Args = stdout, nil
+	defer func() { object.Stdout, object.Args = previousStdout, previousArgs }()
+
+	if len(args) == 0 {
+		args = []string{"repl"}
+	}
+
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(stderr, "monkey: unknown command %q\n\n", args[0])
+		c.usage(stderr)
+		return 2
+	}
+
+	if err := cmd.run(c, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// lookupCommand returns the command called name, or nil if there is none.
+func lookupCommand(name string) *command {
+	switch name {
+	case "-h", "-help", "--help":
+		name = "help"
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// usage writes the list of commands to w.
+func (c *cli) usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: monkey <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n", strings.TrimSpace(cmd.name+" "+cmd.args))
+		fmt.Fprintf(w, "        %s\n", cmd.summary)
+	}
+}
+
+// commandUsage writes the usage line of the command called name to stderr and returns errUsage.
+func (c *cli) commandUsage(name string) error {
+	cmd := lookupCommand(name)
+	fmt.Fprintln(c.stderr, strings.TrimSpace("usage: monkey "+cmd.name+" "+cmd.args))
+	return errUsage
+}
+
+// helpCommand prints the list of commands.
+func helpCommand(c *cli, args []string) error {
+	c.usage(c.stdout)
+	return nil
+}
+
+// readSource reads the file at path, or the standard input if path is "-".
+// It also returns the name to use for the file in messages.
+func (c *cli) readSource(path string) (string, []byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(c.stdin)
+		return "<stdin>", data, err
+	}
+
+	data, err := os.ReadFile(path)
+	return path, data, err
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"interpreter/ast"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMonkey runs the command line args with stdin as the standard input.
+func runMonkey(stdin string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	path := writeFile(t, "hello.mk", `puts("hello " + args()[0]); puts(len(args()));`)
+
+	for _, engine := range []string{"vm", "eval"} {
+		status, stdout, stderr := runMonkey("", "run", "-engine", engine, path, "world", "again")
+		if status != 0 {
+			t.Fatalf("%s: exit status %d, stderr=%q", engine, status, stderr)
+		}
+		if stdout != "hello world\n2\n" {
+			t.Errorf("%s: wrong output. got=%q", engine, stdout)
+		}
+	}
+}
+
+func TestRunMacros(t *testing.T) {
+	path := writeFile(t, "macros.mk", `
+let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+unless(10 > 5, puts("not greater"), puts("greater"));
+`)
+
+	for _, engine := range []string{"vm", "eval"} {
+		status, stdout, stderr := runMonkey("", "run", "-engine", engine, path)
+		if status != 0 || stdout != "greater\n" {
+			t.Errorf("engine %s: status=%d, stdout=%q, stderr=%q", engine, status, stdout, stderr)
+		}
+	}
+
+	bad := writeFile(t, "bad.mk", "let m = macro() { 1 };\nm();")
+	status, _, stderr := runMonkey("", "run", bad)
+	expected := bad + ": macro m at 2:1: a macro has to return a quote, got INTEGER\n"
+	if status != 1 || stderr != expected {
+		t.Errorf("wrong error. status=%d, want=%q, got=%q", status, expected, stderr)
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	status, stdout, _ := runMonkey("puts(6 * 7)", "run", "-")
+	if status != 0 || stdout != "42\n" {
+		t.Errorf("wrong result. status=%d, stdout=%q", status, stdout)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stdin  string
+		status int
+		stderr string
+	}{
+		{[]string{"run", "-"}, "let f = fn() {\n  1 / 0\n};\nf();", 1, "<stdin>:2: division by zero\n"},
+		{[]string{"run", "-engine", "eval", "-"}, "1 / 0", 1, "<stdin>: division by zero\n"},
+		{[]string{"run", "-engine", "js", "-"}, "", 2, "monkey run: unknown engine \"js\"\n"},
+		{[]string{"run"}, "", 2, "usage: monkey run [-engine vm|eval] <file> [args...]\n"},
+		{[]string{"nonsense"}, "", 2, "monkey: unknown command \"nonsense\"\n"},
+	}
+
+	for _, tt := range tests {
+		status, _, stderr := runMonkey(tt.stdin, tt.args...)
+		if status != tt.status {
+			t.Errorf("%v: wrong exit status. want=%d, got=%d", tt.args, tt.status, status)
+		}
+		if !strings.HasPrefix(stderr, tt.stderr) {
+			t.Errorf("%v: wrong stderr.\nwant prefix=%q\ngot=%q", tt.args, tt.stderr, stderr)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	good := writeFile(t, "good.mk", "let x = 1;")
+	bad := writeFile(t, "bad.mk", "let = 1;")
+
+	status, stdout, stderr := runMonkey("", "check", good)
+	if status != 0 || stdout != "" || stderr != "" {
+		t.Errorf("good file: status=%d, stdout=%q, stderr=%q", status, stdout, stderr)
+	}
+
+	status, _, stderr = runMonkey("", "check", good, bad)
+	if status != 1 {
+		t.Errorf("bad file: wrong exit status %d", status)
+	}
+	if !strings.Contains(stderr, "error[E0001]") || !strings.Contains(stderr, "bad.mk:1:5") {
+		t.Errorf("bad file: diagnostic missing from stderr=%q", stderr)
+	}
+	if !strings.HasSuffix(stderr, "1 of 2 file(s) have errors\n") {
+		t.Errorf("bad file: summary missing from stderr=%q", stderr)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	status, stdout, _ := runMonkey("let x = 1;", "tokens", "-")
+	expected := `1:1      LET       "let"
+1:5      IDENT     "x"
+1:7      =         "="
+1:9      INT       "1"
+1:10     ;         ";"
+1:11     EOF       ""
+`
+	if status != 0 || stdout != expected {
+		t.Errorf("wrong token dump. status=%d\nwant=%q\ngot =%q", status, expected, stdout)
+	}
+}
+
+func TestParse(t *testing.T) {
+	status, stdout, _ := runMonkey("x + 1", "parse", "-")
+	expected := `Program 1:1-1:6
+  Statements[0]: ExpressionStatement 1:1-1:6
+    Expression: InfixExpression 1:1-1:6 +
+      Left: Identifier 1:1-1:2 x
+      Right: IntegerLiteral 1:5-1:6 1
+`
+	if status != 0 || stdout != expected {
+		t.Errorf("wrong tree. status=%d\nwant=%q\ngot =%q", status, expected, stdout)
+	}
+
+	status, stdout, _ = runMonkey("x + 1", "parse", "--json", "-")
+	decoded, err := ast.DecodeJSON([]byte(stdout))
+	if status != 0 || err != nil || decoded.String() != "(x + 1)" {
+		t.Errorf("wrong JSON tree. status=%d, err=%v, stdout=%q", status, err, stdout)
+	}
+	if !strings.HasPrefix(stdout, "{\n  \"kind\": \"Program\",\n") {
+		t.Errorf("JSON tree is not indented: %q", stdout)
+	}
+
+	status, stdout, stderr := runMonkey("let = 1;", "parse", "-")
+	if status != 1 || !strings.Contains(stdout, "BadStatement") || !strings.Contains(stderr, "error[E0001]") {
+		t.Errorf("broken input: status=%d, stdout=%q, stderr=%q", status, stdout, stderr)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	src := "// Doubles x.\nlet double=fn(x){x*2};\nputs( double(21) )\n"
+	formatted := "// Doubles x.\nlet double = fn(x) {\n  x * 2;\n};\nputs(double(21));\n"
+
+	status, stdout, _ := runMonkey(src, "fmt", "-")
+	if status != 0 || stdout != formatted {
+		t.Errorf("wrong output. status=%d\nwant=%q\ngot =%q", status, formatted, stdout)
+	}
+
+	path := writeFile(t, "prog.mk", src)
+	status, stdout, _ = runMonkey("", "fmt", "-d", path)
+	expected := "--- " + path + ".orig\n+++ " + path + "\n" + `@@ -1,3 +1,5 @@
+ // Doubles x.
+-let double=fn(x){x*2};
+-puts( double(21) )
++let double = fn(x) {
++  x * 2;
++};
++puts(double(21));
+`
+	if status != 0 || stdout != expected {
+		t.Errorf("wrong diff. status=%d\nwant=%q\ngot =%q", status, expected, stdout)
+	}
+
+	if status, stdout, _ := runMonkey("", "fmt", "-w", path); status != 0 || stdout != "" {
+		t.Errorf("fmt -w: status=%d, stdout=%q", status, stdout)
+	}
+	if data, _ := os.ReadFile(path); string(data) != formatted {
+		t.Errorf("wrong file content after fmt -w: %q", data)
+	}
+	if status, stdout, _ := runMonkey("", "fmt", "-d", path); status != 0 || stdout != "" {
+		t.Errorf("diff of a formatted file: status=%d, stdout=%q", status, stdout)
+	}
+
+	broken := writeFile(t, "broken.mk", "let = 1;\n")
+	status, _, stderr := runMonkey("", "fmt", "-w", broken)
+	if status != 1 || !strings.Contains(stderr, "error[E0001]") {
+		t.Errorf("broken input: status=%d, stderr=%q", status, stderr)
+	}
+	if data, _ := os.ReadFile(broken); string(data) != "let = 1;\n" {
+		t.Errorf("broken file was rewritten: %q", data)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var out strings.Builder
+		for i := from; i <= to; i++ {
+			fmt.Fprintf(&out, "%d\n", i)
+		}
+		return out.String()
+	}
+
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"same\n", "same\n", ""},
+		{"", "new\n", "@@ -0,0 +1 @@\n+new\n"},
+		{"old", "old\n", "@@ -1 +1 @@\n-old\n\\ No newline at end of file\n+old\n"},
+		// Changes far apart get hunks of their own, close ones share one.
+		{
+			lines(1, 20),
+			strings.Replace(strings.Replace(lines(1, 20), "2\n", "two\n", 1), "18\n", "", 1),
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n@@ -15,6 +15,5 @@\n 15\n 16\n 17\n-18\n 19\n 20\n",
+		},
+		{
+			lines(1, 10),
+			strings.Replace(strings.Replace(lines(1, 10), "3\n", "", 1), "8\n", "", 1),
+			"@@ -1,10 +1,8 @@\n 1\n 2\n-3\n 4\n 5\n 6\n 7\n-8\n 9\n 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		actual := unifiedDiff("a", "b", tt.a, tt.b)
+		if tt.expected != "" {
+			tt.expected = "--- a\n+++ b\n" + tt.expected
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong diff of %q and %q.\nwant=%q\ngot =%q", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func TestBuildAndRun(t *testing.T) {
+	src := writeFile(t, "prog.mk", "let double = fn(x) { x * 2 }; puts(double(21));")
+
+	if status, _, stderr := runMonkey("", "build", src); status != 0 {
+		t.Fatalf("build failed: %s", stderr)
+	}
+
+	compiled := strings.TrimSuffix(src, ".mk") + ".mkc"
+	status, stdout, stderr := runMonkey("", "run", compiled)
+	if status != 0 || stdout != "42\n" {
+		t.Errorf("run failed. status=%d, stdout=%q, stderr=%q", status, stdout, stderr)
+	}
+
+	status, stdout, _ = runMonkey("", "disasm", compiled)
+	if status != 0 || !strings.Contains(stdout, "fn double") {
+		t.Errorf("disasm failed. status=%d, stdout=%q", status, stdout)
+	}
+}
+
+func TestRepl(t *testing.T) {
+	status, stdout, _ := runMonkey("1 + 2\n", "repl")
+	if status != 0 || !strings.Contains(stdout, ">> 3\n") {
+		t.Errorf("repl failed. status=%d, stdout=%q", status, stdout)
+	}
+}
@@ -0,0 +1,707 @@
+// Package mkc reads and writes compiled Monkey programs in the .mkc file format.
+//
+// A file starts with a fixed header, followed by the body and a checksum:
+//
+//	magic     4 bytes  "MKC\x00"
+//	version   uint16   Version
+//	flags     uint16   FlagDebug if the body contains line tables
+//	length    uint32   length of the body in bytes
+//	body      instructions of the program, [line table], global names, constant pool
+//	checksum  uint32   CRC-32 (IEEE) of the header and the body
+//
+// All integers are big-endian. Byte strings are prefixed with their length as a uint32,
+// lists with their number of elements as a uint32. Every constant starts with a tag byte
+// telling its kind; compiled functions carry their source, the names of their locals and free
+// variables, their instructions and, with FlagDebug, their line table.
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/object"
+	"interpreter/vm"
+	"io"
+)
+
+// Version is the version of the format written by Write. Read only accepts this version.
+const Version = 3
+
+// FlagDebug marks a file that contains line tables.
+const FlagDebug = 1 << 0
+
+// magic identifies a .mkc file.
+var magic = []byte("MKC\x00")
+
+// headerSize is the size of magic, version, flags and length together.
+const headerSize = 4 + 2 + 2 + 4
+
+// Tags of the constant kinds.
+const (
+	tagInteger  byte = 'I'
+	tagBoolean  byte = 'B'
+	tagNull     byte = 'N'
+	tagString   byte = 'S'
+	tagArray    byte = 'A'
+	tagHash     byte = 'H'
+	tagFunction byte = 'F'
+)
+
+// maxDepth limits how deeply arrays and hashes may be nested in the constant pool,
+// so a malicious file can't exhaust the stack of the reader.
+const maxDepth = 64
+
+// Errors returned by Read, possibly wrapped with more detail. Test for them with errors.Is.
+var (
+	ErrNotMkc      = errors.New("not a .mkc file")
+	ErrVersion     = errors.New("unsupported .mkc version")
+	ErrTruncated   = errors.New("truncated .mkc file")
+	ErrCorrupt     = errors.New("corrupt .mkc file")
+	ErrUnencodable = errors.New("constant cannot be encoded")
+)
+
+// IsMkc reports whether data starts with the magic bytes of a .mkc file.
+func IsMkc(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Write encodes bytecode to w. With debug the line tables are included, which lets runtime
+// errors report source lines at the cost of a larger file.
+func Write(w io.Writer, bytecode *compiler.Bytecode, debug bool) error {
+	e := &encoder{debug: debug}
+
+	e.bytes(bytecode.Instructions)
+	if debug {
+		e.lines(bytecode.Lines)
+	}
+
+	e.strings(bytecode.GlobalNames)
+
+	e.uint32(len(bytecode.Constants))
+	for _, constant := range bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+
+	flags := 0
+	if debug {
+		flags |= FlagDebug
+	}
+
+	var file bytes.Buffer
+	file.Write(magic)
+	binary.Write(&file, binary.BigEndian, uint16(Version))
+	binary.Write(&file, binary.BigEndian, uint16(flags))
+	binary.Write(&file, binary.BigEndian, uint32(e.buf.Len()))
+	file.Write(e.buf.Bytes())
+	binary.Write(&file, binary.BigEndian, crc32.ChecksumIEEE(file.Bytes()))
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Read decodes a compiled program from r. Truncated and corrupted input is rejected,
+// and so are instructions that refer to constants, globals, locals, builtins or free variables
+// that don't exist, and instructions that would pop more values than the stack holds.
+func Read(r io.Reader) (*compiler.Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(magic) || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrNotMkc
+	}
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: incomplete header", ErrTruncated)
+	}
+
+	version := binary.BigEndian.Uint16(data[4:])
+	if version != Version {
+		return nil, fmt.Errorf("%w: %d, want %d", ErrVersion, version, Version)
+	}
+	flags := binary.BigEndian.Uint16(data[6:])
+	if flags&^FlagDebug != 0 {
+		return nil, fmt.Errorf("%w: unknown flags %#x", ErrCorrupt, flags)
+	}
+
+	length := int64(binary.BigEndian.Uint32(data[8:]))
+	size := int64(headerSize) + length + 4
+	if int64(len(data)) < size {
+		return nil, fmt.Errorf("%w: want %d bytes, got %d", ErrTruncated, size, len(data))
+	}
+	if int64(len(data)) > size {
+		return nil, fmt.Errorf("%w: %d bytes of trailing data", ErrCorrupt, int64(len(data))-size)
+	}
+
+	checked := data[:size-4]
+	if binary.BigEndian.Uint32(data[size-4:]) != crc32.ChecksumIEEE(checked) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	d := &decoder{data: data[headerSize : size-4], debug: flags&FlagDebug != 0}
+	bytecode := d.bytecode()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("%w: %d unused bytes in body", ErrCorrupt, len(d.data)-d.off)
+	}
+
+	if err := validate(bytecode); err != nil {
+		return nil, err
+	}
+
+	return bytecode, nil
+}
+
+// encoder appends the encoded body of a file to buf.
+type encoder struct {
+	buf   bytes.Buffer
+	debug bool
+}
+
+func (e *encoder) uint8(v byte) {
+	e.buf.WriteByte(v)
+}
+
+func (e *encoder) uint16(v int) {
+	binary.Write(&e.buf, binary.BigEndian, uint16(v))
+}
+
+func (e *encoder) uint32(v int) {
+	binary.Write(&e.buf, binary.BigEndian, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(len(b))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) strings(list []string) {
+	e.uint32(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) lines(t code.LineTable) {
+	e.uint32(len(t))
+	for _, entry := range t {
+		e.uint32(entry.Offset)
+		e.uint32(entry.Line)
+	}
+}
+
+// constant encodes a value of the constant pool: a tag followed by the value itself.
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.uint8(tagInteger)
+		e.int64(obj.Value)
+
+	case *object.Boolean:
+		e.uint8(tagBoolean)
+		if obj.Value {
+			e.uint8(1)
+		} else {
+			e.uint8(0)
+		}
+
+	case *object.Null:
+		e.uint8(tagNull)
+
+	case *object.String:
+		e.uint8(tagString)
+		e.string(obj.Value)
+
+	case *object.Array:
+		e.uint8(tagArray)
+		e.uint32(len(obj.Elements))
+		for _, el := range obj.Elements {
+			if err := e.constant(el); err != nil {
+				return err
+			}
+		}
+
+	case *object.Hash:
+		e.uint8(tagHash)
+		e.uint32(len(obj.Keys))
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			if err := e.constant(pair.Key); err != nil {
+				return err
+			}
+			if err := e.constant(pair.Value); err != nil {
+				return err
+			}
+		}
+
+	case *object.CompiledFunction:
+		e.uint8(tagFunction)
+		e.string(obj.Name)
+		e.string(obj.Source)
+		e.strings(obj.LocalNames)
+		e.strings(obj.FreeNames)
+		e.uint16(obj.NumParameters)
+		e.uint16(obj.NumLocals)
+		e.bytes(obj.Instructions)
+		if e.debug {
+			e.lines(obj.Lines)
+		}
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnencodable, obj.Type())
+	}
+
+	return nil
+}
+
+// decoder reads the body of a file. The first error sticks: once err is set every read
+// returns zero values, so the decoding functions only have to check it at the end.
+type decoder struct {
+	data  []byte
+	off   int
+	debug bool
+	err   error
+}
+
+// fail records err unless an earlier error was already recorded.
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// next returns the next n bytes, or nil if there aren't that many left.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.off {
+		d.fail(fmt.Errorf("%w: unexpected end of body at offset %d", ErrCorrupt, d.off))
+		return nil
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() int {
+	if b := d.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) uint32() int {
+	if b := d.next(4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// count reads the length of a list whose elements take up at least minSize bytes each,
+// and rejects lengths the rest of the body can't possibly hold.
+func (d *decoder) count(minSize int) int {
+	n := d.uint32()
+	if n > (len(d.data)-d.off)/minSize {
+		d.fail(fmt.Errorf("%w: list of %d elements at offset %d exceeds the body", ErrCorrupt, n, d.off))
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	b := d.next(d.count(1))
+	if b == nil {
+		return []byte{}
+	}
+	return append([]byte{}, b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	list := make([]string, d.count(4))
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) lines() code.LineTable {
+	n := d.count(8)
+	t := make(code.LineTable, n)
+	for i := range t {
+		t[i] = code.LineEntry{Offset: d.uint32(), Line: d.uint32()}
+	}
+	return t
+}
+
+// bytecode decodes the body of a file.
+func (d *decoder) bytecode() *compiler.Bytecode {
+	bytecode := &compiler.Bytecode{}
+
+	bytecode.Instructions = d.bytes()
+	if d.debug {
+		bytecode.Lines = d.lines()
+	}
+
+	bytecode.GlobalNames = d.strings()
+
+	bytecode.Constants = make([]object.Object, d.count(1))
+	for i := range bytecode.Constants {
+		bytecode.Constants[i] = d.constant(0)
+	}
+
+	return bytecode
+}
+
+// constant decodes a value of the constant pool. depth is how deeply it's nested in arrays and hashes.
+func (d *decoder) constant(depth int) object.Object {
+	if depth > maxDepth {
+		d.fail(fmt.Errorf("%w: constants nested too deeply", ErrCorrupt))
+		return nil
+	}
+
+	offset := d.off
+	switch tag := d.uint8(); tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int64()}
+
+	// The virtual machine compares booleans and null by identity, so they decode to its singletons.
+	case tagBoolean:
+		switch d.uint8() {
+		case 0:
+			return vm.False
+		case 1:
+			return vm.True
+		default:
+			d.fail(fmt.Errorf("%w: invalid boolean at offset %d", ErrCorrupt, offset))
+			return nil
+		}
+
+	case tagNull:
+		return vm.Null
+
+	case tagString:
+		return &object.String{Value: d.string()}
+
+	case tagArray:
+		elements := make([]object.Object, d.count(1))
+		for i := range elements {
+			elements[i] = d.constant(depth + 1)
+		}
+		return &object.Array{Elements: elements}
+
+	case tagHash:
+		hash := object.NewHash()
+		n := d.count(2)
+		for i := 0; i < n && d.err == nil; i++ {
+			key := d.constant(depth + 1)
+			value := d.constant(depth + 1)
+			if d.err != nil {
+				break
+			}
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				d.fail(fmt.Errorf("%w: unusable hash key %s at offset %d", ErrCorrupt, key.Type(), offset))
+				break
+			}
+			hash.Set(hashKey, value)
+		}
+		return hash
+
+	case tagFunction:
+		fn := &object.CompiledFunction{}
+		fn.Name = d.string()
+		fn.Source = d.string()
+		fn.LocalNames = d.strings()
+		fn.FreeNames = d.strings()
+		fn.NumParameters = d.uint16()
+		fn.NumLocals = d.uint16()
+		fn.Instructions = d.bytes()
+		if d.debug {
+			fn.Lines = d.lines()
+		}
+		return fn
+
+	default:
+		d.fail(fmt.Errorf("%w: unknown constant tag %#x at offset %d", ErrCorrupt, tag, offset))
+		return nil
+	}
+}
+
+// validate checks that the instructions only refer to things that exist and keep the stack
+// balanced, so the virtual machine can run them without reading out of bounds.
+func validate(bytecode *compiler.Bytecode) error {
+	// The number of free variables a function uses is only known from its instructions,
+	// but it's checked where the closure is created.
+	numFree := map[*object.CompiledFunction]int{}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			numFree[fn] = freeVariablesUsed(fn.Instructions)
+		}
+	}
+
+	if err := validateInstructions(bytecode, bytecode.Instructions, nil, numFree); err != nil {
+		return fmt.Errorf("%w: main: %s", ErrCorrupt, err)
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("%w: constant %d: %d parameters but only %d locals",
+				ErrCorrupt, i, fn.NumParameters, fn.NumLocals)
+		}
+		if err := validateInstructions(bytecode, fn.Instructions, fn, numFree); err != nil {
+			return fmt.Errorf("%w: constant %d: %s", ErrCorrupt, i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateInstructions checks a single instruction stream. fn is the function it belongs to,
+// or nil for the top level of the program. numFree tells how many free variables each function uses.
+// Jumps have to land on the start of an instruction or the end of the stream, or the virtual machine
+// would decode operand bytes as opcodes.
+func validateInstructions(bytecode *compiler.Bytecode, ins code.Instructions, fn *object.CompiledFunction,
+	numFree map[*object.CompiledFunction]int) error {
+	// starts marks the offsets where an instruction starts, and the end of the stream.
+	starts := make([]bool, len(ins)+1)
+	starts[len(ins)] = true
+	type jump struct{ offset, target int }
+	var jumps []jump
+
+	for i := 0; i < len(ins); {
+		starts[i] = true
+
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("offset %d: %s", i, err)
+		}
+
+		width := def.Width()
+		if i+1+width > len(ins) {
+			return fmt.Errorf("offset %d: %s is missing operand bytes", i, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(bytecode.Constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", i, operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(bytecode.Constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", i, operands[0])
+			}
+			closed, ok := bytecode.Constants[operands[0]].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("offset %d: constant %d is not a function", i, operands[0])
+			}
+			if operands[1] < numFree[closed] {
+				return fmt.Errorf("offset %d: closure captures %d free variables, function uses %d",
+					i, operands[1], numFree[closed])
+			}
+		case code.OpJump, code.OpJumpNotTruthy:
+			if operands[0] > len(ins) {
+				return fmt.Errorf("offset %d: jump target %d out of range", i, operands[0])
+			}
+			jumps = append(jumps, jump{i, operands[0]})
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= len(bytecode.GlobalNames) {
+				return fmt.Errorf("offset %d: global %d out of range", i, operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+			if fn == nil || operands[0] >= fn.NumLocals {
+				return fmt.Errorf("offset %d: local %d out of range", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return fmt.Errorf("offset %d: builtin %d out of range", i, operands[0])
+			}
+		case code.OpGetFree, code.OpCaptureFree, code.OpCurrentClosure:
+			if fn == nil {
+				return fmt.Errorf("offset %d: %s outside of a function", i, def.Name)
+			}
+		}
+
+		i += 1 + width
+	}
+
+	for _, j := range jumps {
+		if !starts[j.target] {
+			return fmt.Errorf("offset %d: jump target %d is inside an instruction", j.offset, j.target)
+		}
+	}
+
+	return validateStack(ins, fn != nil)
+}
+
+// validateStack follows every path through ins, which validateInstructions already found to decode,
+// and checks that no instruction pops more values than the path pushed before it, and that all
+// the paths reaching an instruction agree on the depth of the stack there. A function has to
+// return on every path; the top level of the program may also run off its end.
+func validateStack(ins code.Instructions, isFunction bool) error {
+	depths := make([]int, len(ins)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+
+	// reach records that the instruction at target is reached with depth values on the stack,
+	// and queues it if it hasn't been reached before.
+	var queue []int
+	reach := func(from, target, depth int) error {
+		if target == len(ins) && isFunction {
+			return fmt.Errorf("offset %d: function ends without returning", from)
+		}
+		if depths[target] == -1 {
+			depths[target] = depth
+			queue = append(queue, target)
+			return nil
+		}
+		if depths[target] != depth {
+			return fmt.Errorf("offset %d: stack holds %d value(s) at offset %d, another path leaves %d",
+				from, depth, target, depths[target])
+		}
+		return nil
+	}
+
+	if err := reach(0, 0, 0); err != nil {
+		return err
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if i == len(ins) {
+			continue
+		}
+
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		pops, pushes := stackEffect(op, operands)
+		if pops > depths[i] {
+			return fmt.Errorf("offset %d: %s needs %d value(s) on the stack, found %d", i, def.Name, pops, depths[i])
+		}
+		if op == code.OpHash && operands[0]%2 != 0 {
+			return fmt.Errorf("offset %d: OpHash with an odd number of keys and values", i)
+		}
+		depth := depths[i] - pops + pushes
+
+		var err error
+		switch op {
+		case code.OpReturnValue, code.OpReturn:
+			// The path ends here.
+		case code.OpJump:
+			err = reach(i, operands[0], depth)
+		case code.OpJumpNotTruthy:
+			if err = reach(i, operands[0], depth); err == nil {
+				err = reach(i, next, depth)
+			}
+		default:
+			err = reach(i, next, depth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns how many values the instruction op pops off the stack and how many it pushes.
+func stackEffect(op code.Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpReturnValue:
+		return 1, 0
+	case code.OpJump, code.OpReturn:
+		return 0, 0
+	case code.OpMinus, code.OpBang, code.OpBitNot:
+		return 1, 1
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+		code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpLessEqual,
+		code.OpGreaterThan, code.OpGreaterEqual, code.OpIndex:
+		return 2, 1
+	case code.OpArray, code.OpHash:
+		return operands[0], 1
+	case code.OpSlice:
+		pops = 1
+		if operands[0]&code.SliceLow != 0 {
+			pops++
+		}
+		if operands[0]&code.SliceHigh != 0 {
+			pops++
+		}
+		return pops, 1
+	case code.OpCall:
+		// The function and its arguments are replaced by the result.
+		return operands[0] + 1, 1
+	case code.OpClosure:
+		return operands[1], 1
+	default:
+		// Everything else pushes a single value: constants, variables, builtins and closures.
+		return 0, 1
+	}
+}
+
+// freeVariablesUsed returns one more than the highest free variable index read by ins.
+// Counting stops at an instruction that doesn't decode; validateInstructions reports those.
+func freeVariablesUsed(ins code.Instructions) int {
+	used := 0
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil || i+1+def.Width() > len(ins) {
+			break
+		}
+
+		if op := code.Opcode(ins[i]); op == code.OpGetFree || op == code.OpCaptureFree {
+			if index := int(ins[i+1]); index >= used {
+				used = index + 1
+			}
+		}
+
+		i += 1 + def.Width()
+	}
+	return used
+}
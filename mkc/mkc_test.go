@@ -0,0 +1,356 @@
+package mkc
+
+import (
+	"bytes"
+	"errors"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/vm"
+	"strings"
+	"testing"
+)
+
+const program = `let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+};
+let adder = fn(a) { fn(b) { a + b } };
+let names = {"one": 1, "two": 2};
+[fib(10), adder(1)(2), names["two"], len("héllo")]`
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(prog); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, bytecode *compiler.Bytecode, debug bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, bytecode, debug); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		original := compile(t, program)
+
+		decoded, err := Read(bytes.NewReader(encode(t, original, debug)))
+		if err != nil {
+			t.Fatalf("Read failed: %s", err)
+		}
+
+		if !bytes.Equal(decoded.Instructions, original.Instructions) {
+			t.Errorf("instructions differ.\nwant=%q\ngot =%q", original.Instructions, decoded.Instructions)
+		}
+		if decoded.Disassemble() != original.Disassemble() {
+			t.Errorf("disassembly differs.\nwant=\n%s\ngot=\n%s", original.Disassemble(), decoded.Disassemble())
+		}
+		if (len(decoded.Lines) != 0) != debug {
+			t.Errorf("debug=%t, but decoded line table is %v", debug, decoded.Lines)
+		}
+
+		machine := vm.New(decoded)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := machine.LastPoppedStackElem().Inspect(); got != "[55, 3, 2, 5]" {
+			t.Errorf("wrong result. got=%s", got)
+		}
+	}
+}
+
+func TestLineTablesSurvive(t *testing.T) {
+	decoded, err := Read(bytes.NewReader(encode(t, compile(t, "let f = fn() {\n  1 / 0\n};\nf();"), true)))
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+
+	err = vm.New(decoded).Run()
+	vmErr, ok := err.(*vm.Error)
+	if !ok || vmErr.Line != 2 {
+		t.Errorf("expected a runtime error on line 2, got=%#v", err)
+	}
+}
+
+func TestConstantKinds(t *testing.T) {
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "b"}, &object.Integer{Value: 1})
+	hash.Set(&object.Integer{Value: 7}, &object.Boolean{Value: true})
+	hash.Set(&object.Boolean{Value: false}, &object.Null{})
+
+	constants := []object.Object{
+		&object.Integer{Value: -1 << 62},
+		&object.Boolean{Value: true},
+		&object.Null{},
+		&object.String{Value: "héllo\n"},
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.Array{}}},
+		hash,
+		&object.CompiledFunction{
+			Name:          "f",
+			Source:        "fn(x) {\n\n}",
+			LocalNames:    []string{"x", "y"},
+			FreeNames:     []string{"z"},
+			NumParameters: 1,
+			NumLocals:     2,
+			Instructions:  code.Make(code.OpReturn),
+			Lines:         code.LineTable{{Offset: 0, Line: 3}},
+		},
+	}
+
+	decoded, err := Read(bytes.NewReader(encode(t, &compiler.Bytecode{Constants: constants}, true)))
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+
+	if len(decoded.Constants) != len(constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(constants), len(decoded.Constants))
+	}
+	for i, want := range constants[:6] {
+		got := decoded.Constants[i]
+		if got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+			t.Errorf("constant %d differs. want=%s %s, got=%s %s", i, want.Type(), want.Inspect(), got.Type(), got.Inspect())
+		}
+	}
+
+	fn, ok := decoded.Constants[6].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 6 is not a function. got=%T", decoded.Constants[6])
+	}
+	if fn.Name != "f" || fn.Source != "fn(x) {\n\n}" ||
+		strings.Join(fn.LocalNames, ",") != "x,y" || strings.Join(fn.FreeNames, ",") != "z" || fn.NumParameters != 1 || fn.NumLocals != 2 ||
+		!bytes.Equal(fn.Instructions, code.Make(code.OpReturn)) || fn.Lines.Line(0) != 3 {
+		t.Errorf("function differs. got=%+v", fn)
+	}
+}
+
+func TestDecodesSingletons(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		// The constant true has to be the same true OpTrue pushes for == to hold.
+		Instructions: concat(code.Make(code.OpConstant, 0), code.Make(code.OpTrue), code.Make(code.OpEqual), code.Make(code.OpPop)),
+		Constants: []object.Object{
+			&object.Boolean{Value: true},
+			&object.Boolean{Value: false},
+			&object.Null{},
+			&object.Array{Elements: []object.Object{&object.Null{}}},
+		},
+	}
+
+	decoded, err := Read(bytes.NewReader(encode(t, bytecode, false)))
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+
+	constants := decoded.Constants
+	if constants[0] != vm.True || constants[1] != vm.False || constants[2] != vm.Null ||
+		constants[3].(*object.Array).Elements[0] != vm.Null {
+		t.Errorf("constants not decoded to the singletons of the virtual machine: %v", constants)
+	}
+
+	machine := vm.New(decoded)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result := machine.LastPoppedStackElem(); result != vm.True {
+		t.Errorf("decoded true != true. got=%v", result)
+	}
+}
+
+func TestUnencodableConstant(t *testing.T) {
+	bytecode := &compiler.Bytecode{Constants: []object.Object{object.Builtins[0]}}
+
+	err := Write(&bytes.Buffer{}, bytecode, false)
+	if !errors.Is(err, ErrUnencodable) {
+		t.Errorf("expected ErrUnencodable, got=%v", err)
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	data := encode(t, compile(t, program), true)
+
+	for n := 0; n < len(data); n++ {
+		_, err := Read(bytes.NewReader(data[:n]))
+		if n < len(magic) {
+			if !errors.Is(err, ErrNotMkc) {
+				t.Fatalf("%d bytes: expected ErrNotMkc, got=%v", n, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("%d bytes: expected ErrTruncated, got=%v", n, err)
+		}
+	}
+}
+
+func TestCorruptedInput(t *testing.T) {
+	data := encode(t, compile(t, program), true)
+
+	// Flipping any bit after the header fields that are checked on their own must be noticed.
+	for i := headerSize; i < len(data); i++ {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0x10
+
+		if _, err := Read(bytes.NewReader(corrupted)); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("byte %d: expected ErrCorrupt, got=%v", i, err)
+		}
+	}
+
+	if _, err := Read(bytes.NewReader(append(data, 0))); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("trailing data: expected ErrCorrupt, got=%v", err)
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	data := encode(t, compile(t, "1"), false)
+
+	notMkc := append([]byte{}, data...)
+	notMkc[0] = 'X'
+	if _, err := Read(bytes.NewReader(notMkc)); !errors.Is(err, ErrNotMkc) {
+		t.Errorf("expected ErrNotMkc, got=%v", err)
+	}
+
+	newer := append([]byte{}, data...)
+	newer[5] = Version + 1
+	if _, err := Read(bytes.NewReader(newer)); !errors.Is(err, ErrVersion) {
+		t.Errorf("expected ErrVersion, got=%v", err)
+	}
+}
+
+func TestInvalidInstructions(t *testing.T) {
+	fn := &object.CompiledFunction{Instructions: concat(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue))}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+	}{
+		{"unknown opcode", &compiler.Bytecode{Instructions: code.Instructions{255}}},
+		{"missing operand", &compiler.Bytecode{Instructions: code.Instructions{byte(code.OpConstant), 0}}},
+		{"constant out of range", &compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1)}},
+		{"global out of range", &compiler.Bytecode{Instructions: code.Make(code.OpGetGlobal, 0)}},
+		{"local at top level", &compiler.Bytecode{Instructions: code.Make(code.OpGetLocal, 0)}},
+		{"captured local at top level", &compiler.Bytecode{Instructions: code.Make(code.OpCaptureLocal, 0)}},
+		{"captured free variable at top level", &compiler.Bytecode{Instructions: code.Make(code.OpCaptureFree, 0)}},
+		{"builtin out of range", &compiler.Bytecode{Instructions: code.Make(code.OpGetBuiltin, 255)}},
+		{"jump out of range", &compiler.Bytecode{Instructions: code.Make(code.OpJump, 100)}},
+		{
+			// The target is the operand of the OpConstant, which would be decoded as another one.
+			"jump inside an instruction",
+			&compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0)),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+		},
+		{
+			"closure over a non-function",
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+		},
+		{
+			"closure without its free variables",
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(encode(t, tt.bytecode, false)))
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got=%v", tt.name, err)
+		}
+	}
+}
+
+func TestStackValidation(t *testing.T) {
+	one := []object.Object{&object.Integer{Value: 1}}
+	returning := func(ins ...[]byte) *compiler.Bytecode {
+		fn := &object.CompiledFunction{Instructions: concat(ins...)}
+		return &compiler.Bytecode{
+			Instructions: concat(code.Make(code.OpClosure, 1, 0), code.Make(code.OpPop)),
+			Constants:    []object.Object{one[0], fn},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+		err      string // Empty if the instructions are valid.
+	}{
+		{
+			"balanced conditional",
+			&compiler.Bytecode{
+				Instructions: concat(
+					code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 10), code.Make(code.OpConstant, 0),
+					code.Make(code.OpJump, 11), code.Make(code.OpNull), code.Make(code.OpPop)),
+				Constants: one,
+			},
+			"",
+		},
+		{
+			"loop",
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 7), code.Make(code.OpJump, 0))},
+			"",
+		},
+		{"function returning on every path", returning(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpReturn), code.Make(code.OpNull), code.Make(code.OpReturnValue)), ""},
+		{"pop from an empty stack", &compiler.Bytecode{Instructions: code.Make(code.OpPop)}, "main: offset 0: OpPop needs 1 value(s) on the stack, found 0"},
+		{"return from an empty stack", &compiler.Bytecode{Instructions: code.Make(code.OpReturnValue)}, "main: offset 0: OpReturnValue needs 1 value(s) on the stack, found 0"},
+		{"call without a function", &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpCall, 1))}, "main: offset 1: OpCall needs 2 value(s) on the stack, found 1"},
+		{"operator with a single operand", &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpAdd))}, "main: offset 1: OpAdd needs 2 value(s) on the stack, found 1"},
+		{"odd hash", &compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpHash, 1))}, "main: offset 1: OpHash with an odd number of keys and values"},
+		{
+			"unbalanced conditional",
+			&compiler.Bytecode{
+				Instructions: concat(
+					code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 6), code.Make(code.OpTrue), code.Make(code.OpTrue),
+					code.Make(code.OpPop)),
+			},
+			"main: offset 5: stack holds 2 value(s) at offset 6, another path leaves 0",
+		},
+		{
+			"growing loop",
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpJump, 0))},
+			"main: offset 1: stack holds 1 value(s) at offset 0, another path leaves 0",
+		},
+		{"function running off its end", returning(code.Make(code.OpNull), code.Make(code.OpPop)), "constant 1: offset 1: function ends without returning"},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(encode(t, tt.bytecode, false)))
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrCorrupt) || err.Error() != ErrCorrupt.Error()+": "+tt.err {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func concat(ins ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, i := range ins {
+		out = append(out, i...)
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// BuiltinFunction is the signature of a function implemented in Go and callable from Monkey.
+// It returns nil when it has no meaningful result; the caller turns that into null.
+// Problems like a wrong argument count or type are reported by returning an *Error.
+type BuiltinFunction func(args ...Object) Object
+
+// Builtin is a Go function made available to Monkey code under Name.
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+// Type returns BUILTIN_OBJ.
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+
+// Inspect returns "builtin function" followed by the name.
+func (b *Builtin) Inspect() string { return "builtin function " + b.Name }
+
+// Stdout is where puts writes to. Programs embedding the interpreter can point it elsewhere.
+var Stdout io.Writer = os.Stdout
+
+// Args is what the args builtin returns: the arguments a program was started with.
+// Programs embedding the interpreter set it before running a program.
+var Args []string
+
+// Builtins is the registry of builtin functions, consulted when a name isn't bound in the environment.
+// The position of a builtin in the slice is its identity for compiled code,
+// so builtins are only ever appended or replaced in place, never removed or reordered.
+var Builtins = []*Builtin{
+	{Name: "len", Fn: builtinLen},
+	{Name: "puts", Fn: builtinPuts},
+	{Name: "first", Fn: builtinFirst},
+	{Name: "last", Fn: builtinLast},
+	{Name: "rest", Fn: builtinRest},
+	{Name: "push", Fn: builtinPush},
+	{Name: "type", Fn: builtinType},
+	{Name: "args", Fn: builtinArgs},
+}
+
+// RegisterBuiltin makes fn callable from Monkey under name.
+// Registering a name that already exists replaces the existing builtin.
+func RegisterBuiltin(name string, fn BuiltinFunction) {
+	for _, b := range Builtins {
+		if b.Name == name {
+			b.Fn = fn
+			return
+		}
+	}
+	Builtins = append(Builtins, &Builtin{Name: name, Fn: fn})
+}
+
+// GetBuiltinByName returns the builtin registered under name.
+func GetBuiltinByName(name string) (*Builtin, bool) {
+	for _, b := range Builtins {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// NewError creates an Error with a formatted message. Builtins use it to report bad arguments.
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// CheckArity returns an error if the number of arguments isn't want, and nil otherwise.
+func CheckArity(args []Object, want int) *Error {
+	if len(args) != want {
+		return NewError("wrong number of arguments: want=%d, got=%d", want, len(args))
+	}
+	return nil
+}
+
+// builtinLen returns the number of characters of a string, elements of an array or pairs of a hash.
+func builtinLen(args ...Object) Object {
+	if err := CheckArity(args, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(len([]rune(arg.Value)))}
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *Hash:
+		return &Integer{Value: int64(len(arg.Pairs))}
+	default:
+		return NewError("argument to `len` not supported, got %s", args[0].Type())
+	}
+}
+
+// builtinPuts prints every argument on a line of its own and returns null.
+func builtinPuts(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(Stdout, arg.Inspect())
+	}
+	return nil
+}
+
+// builtinFirst returns the first element of an array, or null if it's empty.
+func builtinFirst(args ...Object) Object {
+	if err := CheckArity(args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to `first` must be ARRAY, got %s", args[0].Type())
+	}
+
+	if len(array.Elements) > 0 {
+		return array.Elements[0]
+	}
+	return nil
+}
+
+// builtinLast returns the last element of an array, or null if it's empty.
+func builtinLast(args ...Object) Object {
+	if err := CheckArity(args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to `last` must be ARRAY, got %s", args[0].Type())
+	}
+
+	length := len(array.Elements)
+	if length > 0 {
+		return array.Elements[length-1]
+	}
+	return nil
+}
+
+// builtinRest returns a new array with every element but the first, or null if the array is empty.
+func builtinRest(args ...Object) Object {
+	if err := CheckArity(args, 1); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+	}
+
+	length := len(array.Elements)
+	if length > 0 {
+		newElements := make([]Object, length-1)
+		copy(newElements, array.Elements[1:length])
+		return &Array{Elements: newElements}
+	}
+	return nil
+}
+
+// builtinPush returns a new array with the second argument appended; the original array is unchanged.
+func builtinPush(args ...Object) Object {
+	if err := CheckArity(args, 2); err != nil {
+		return err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return NewError("argument to `push` must be ARRAY, got %s", args[0].Type())
+	}
+
+	length := len(array.Elements)
+	newElements := make([]Object, length+1)
+	copy(newElements, array.Elements)
+	newElements[length] = args[1]
+
+	return &Array{Elements: newElements}
+}
+
+// builtinType returns the type of its argument as a string, e.g. "INTEGER".
+func builtinType(args ...Object) Object {
+	if err := CheckArity(args, 1); err != nil {
+		return err
+	}
+	return &String{Value: string(args[0].Type())}
+}
+
+// builtinArgs returns the arguments the program was started with, from Args, as an array of strings.
+func builtinArgs(args ...Object) Object {
+	if err := CheckArity(args, 0); err != nil {
+		return err
+	}
+
+	elements := make([]Object, len(Args))
+	for i, arg := range Args {
+		elements[i] = &String{Value: arg}
+	}
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,56 @@
+package object
+
+import (
+	"fmt"
+	"interpreter/code"
+)
+
+// COMPILED_FUNCTION_OBJ is the type of a function compiled to bytecode.
+// Compiled functions only live in the constant pool; at runtime they're always wrapped in a Closure.
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+// CompiledFunction is the bytecode of a function literal, produced by the compiler.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int    // How many local bindings, parameters included, the function needs room for.
+	NumParameters int    // How many arguments the function expects.
+	Name          string // The name the function was bound to with let, if any. Only used for display.
+	Source        string // The function literal as Function.Inspect renders it. Only used for display.
+
+	// LocalNames and FreeNames are the names of the locals and free variables, indexed by their slot,
+	// for error messages.
+	LocalNames []string
+	FreeNames  []string
+
+	// Lines maps the instructions back to source lines. It's debug information and may be empty.
+	Lines code.LineTable
+}
+
+// Type returns COMPILED_FUNCTION_OBJ.
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+
+// Inspect returns the name of the function and its address.
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%s %p]", cf.Name, cf)
+}
+
+// Closure is a compiled function together with the free variables it captured when it was created.
+// The virtual machine captures variables by reference, so Free may hold its own cells.
+// It's the virtual machine's counterpart of Function, so it reports FUNCTION_OBJ as its type
+// and Monkey code can't tell the two apart.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Type returns FUNCTION_OBJ.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+
+// Inspect renders the function as source code, like Function.Inspect does. Functions without
+// source, like the top level of a program, get their name and the address of the closure instead.
+func (c *Closure) Inspect() string {
+	if c.Fn.Source != "" {
+		return c.Fn.Source
+	}
+	return fmt.Sprintf("Closure[%s %p]", c.Fn.Name, c)
+}
@@ -0,0 +1,49 @@
+package object
+
+import "sort"
+
+// Environment maps names to the values bound to them with let statements or as function parameters.
+// Every function call gets a new Environment that is enclosed by the one the function was defined in,
+// so lookups that fail in the inner environment continue in the outer one.
+type Environment struct {
+	store map[string]Object // The bindings of this environment.
+	outer *Environment      // The enclosing environment, or nil for the global one.
+}
+
+// NewEnvironment creates an empty top-level environment.
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// NewEnclosedEnvironment creates an empty environment that falls back to outer for lookups.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get looks up name in this environment and then in the enclosing ones.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name to val in this environment, shadowing any binding of the enclosing ones.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Names returns the names bound in this environment, without those of the enclosing ones, in sorted order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,297 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"interpreter/ast"
+	"strings"
+)
+
+// ObjectType identifies what kind of value an Object is.
+// Like token.TokenType it's a string, which makes it easy to print in error messages.
+type ObjectType string
+
+// Object types in the language.
+const (
+	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILTIN_OBJ      = "BUILTIN"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+)
+
+// Object is the interface every value produced by the evaluator implements.
+// Type() tells us what kind of value it is and Inspect() renders it for the REPL.
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Integer wraps a Monkey integer.
+type Integer struct {
+	Value int64
+}
+
+// Type returns INTEGER_OBJ.
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+
+// Inspect returns the integer in decimal notation.
+func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
+
+// Boolean wraps a Monkey boolean.
+type Boolean struct {
+	Value bool
+}
+
+// Type returns BOOLEAN_OBJ.
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+
+// Inspect returns "true" or "false".
+func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
+
+// String wraps a Monkey string.
+type String struct {
+	Value string
+}
+
+// Type returns STRING_OBJ.
+func (s *String) Type() ObjectType { return STRING_OBJ }
+
+// Inspect returns the content of the string, without quotes.
+func (s *String) Inspect() string { return s.Value }
+
+// Array is an ordered list of values of any type.
+type Array struct {
+	Elements []Object
+}
+
+// Type returns ARRAY_OBJ.
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+
+// Inspect renders the elements between brackets.
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashKey is what a value is stored under in a Hash.
+// Two values that are equal produce the same HashKey, e.g. two different String objects with the same content.
+// The type is part of the key, so 1 and true don't collide.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as keys in a Hash.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+// HashKey returns the integer's value as the key.
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// HashKey returns 1 for true and 0 for false.
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	} else {
+		value = 0
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// HashKey returns the FNV-1a hash of the string's content.
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// HashPair holds a key of a Hash together with its value.
+// The original key is kept so it can be printed and iterated over.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps hashable keys to values. Besides the map it keeps the keys in the order
+// they were first inserted, so iterating over and printing a hash is deterministic.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // The keys of Pairs, in insertion order.
+}
+
+// NewHash creates an empty Hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set stores value under key. A key that is already present keeps its place in the order.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key.(Object), Value: value}
+}
+
+// Get returns the value stored under key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Type returns HASH_OBJ.
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+// Inspect renders the pairs between braces, in insertion order.
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Null represents the absence of a value, e.g. the result of an if without an else whose condition is false.
+type Null struct{}
+
+// Type returns NULL_OBJ.
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+
+// Inspect returns "null".
+func (n *Null) Inspect() string { return "null" }
+
+// ReturnValue wraps the value of a return statement.
+// The wrapper tells the evaluator to stop evaluating the enclosing statements and hand the value upwards.
+type ReturnValue struct {
+	Value Object
+}
+
+// Type returns RETURN_VALUE_OBJ.
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+
+// Inspect returns the Inspect() of the wrapped value.
+func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
+
+// Error is produced when evaluation fails, e.g. for 'true + 1'.
+// Like a ReturnValue it stops the evaluation of the enclosing statements.
+type Error struct {
+	Message string
+}
+
+// Type returns ERROR_OBJ.
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+// Inspect returns the message prefixed with "ERROR: ".
+func (e *Error) Inspect() string { return "ERROR: " + e.Message }
+
+// Function is a function value. Besides the parameters and body from the AST it keeps
+// the environment it was defined in, which is what makes closures work.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type returns FUNCTION_OBJ.
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+// Inspect renders the function as source code.
+func (f *Function) Inspect() string {
+	return FunctionSource(f.Parameters, f.Body)
+}
+
+// FunctionSource renders a function literal with parameters and body as source code.
+// The compiler keeps it in CompiledFunction, so both engines print functions the same way.
+func FunctionSource(parameters []*ast.Identifier, body *ast.BlockStatement) string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Quote is the value of 'quote(<expression>)': the syntax tree of the expression, unevaluated.
+// Macros return quotes, and the code they hold replaces the macro call.
+type Quote struct {
+	Node ast.Node
+}
+
+// Type returns QUOTE_OBJ.
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+
+// Inspect renders the quoted code as "QUOTE(<code>)".
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is a macro defined with a macro literal. Like a Function it keeps the environment
+// it was defined in, which is the macro environment of the expansion.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type returns MACRO_OBJ.
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+
+// Inspect renders the macro as source code.
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
@@ -0,0 +1,91 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeysIncludeType(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("1 and true have the same hash key")
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 2}, &Boolean{Value: true})
+	hash.Set(&String{Value: "a"}, &Integer{Value: 3})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	expected := "{b: 4, 2: true, a: 3}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. expected=%q, got=%q", expected, hash.Inspect())
+	}
+
+	value, ok := hash.Get(&Integer{Value: 2})
+	if !ok || value.Inspect() != "true" {
+		t.Errorf("hash.Get(2) wrong. got=%v, %t", value, ok)
+	}
+
+	if _, ok := hash.Get(&String{Value: "c"}); ok {
+		t.Errorf("hash.Get(\"c\") found a value")
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("outer", &Integer{Value: 1})
+	env := NewEnclosedEnvironment(outer)
+	env.Set("b", &Integer{Value: 2})
+	env.Set("a", &Integer{Value: 3})
+	env.Set("b", &Integer{Value: 4})
+
+	if names := strings.Join(env.Names(), ","); names != "a,b" {
+		t.Errorf("wrong names. want=%q, got=%q", "a,b", names)
+	}
+	if names := NewEnvironment().Names(); len(names) != 0 {
+		t.Errorf("empty environment has names: %v", names)
+	}
+}
+
+func TestArgsBuiltin(t *testing.T) {
+	builtin, ok := GetBuiltinByName("args")
+	if !ok {
+		t.Fatalf("args isn't a builtin")
+	}
+
+	previous := Args
+	defer func() { Args = previous }()
+	Args = []string{"a", "b"}
+
+	result, ok := builtin.Fn().(*Array)
+	if !ok || len(result.Elements) != 2 || result.Elements[1].Inspect() != "b" {
+		t.Errorf("wrong result: %#v", builtin.Fn())
+	}
+	if err, ok := builtin.Fn(&Integer{Value: 1}).(*Error); !ok || err.Message != "wrong number of arguments: want=0, got=1" {
+		t.Errorf("wrong error for an argument: %#v", err)
+	}
+}
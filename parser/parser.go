@@ -3,17 +3,74 @@ package parser
 import (
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/token"
+	"strconv"
+)
+
+// Operator precedences, from the weakest to the strongest binding.
+// iota gives every constant an increasing value, so we can compare them with < and >.
+// The bitwise operators follow Go: '|' and '^' bind like '+', '&' and the shifts like '*'.
+const (
+	_ int = iota
+	LOWEST
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
+	EQUALS      // ==
+	LESSGREATER // > or <
+	SUM         // +
+	PRODUCT     // *
+	PREFIX      // -X, !X or ~X
+	CALL        // myFunction(X)
+	INDEX       // array[index]
+)
+
+// precedences maps every infix operator token to how tightly it binds.
+var precedences = map[token.TokenType]int{
+	token.OR:        LOGICAL_OR,
+	token.AND:       LOGICAL_AND,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.LT_EQ:     LESSGREATER,
+	token.GT_EQ:     LESSGREATER,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.PIPE:      SUM,
+	token.CARET:     SUM,
+	token.SLASH:     PRODUCT,
+	token.ASTERISK:  PRODUCT,
+	token.PERCENT:   PRODUCT,
+	token.AMPERSAND: PRODUCT,
+	token.SHL:       PRODUCT,
+	token.SHR:       PRODUCT,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
+}
+
+// A prefixParseFn is called when its token type is found in prefix position, e.g. '-' in '-5'.
+// An infixParseFn is called when its token type is found in infix position; its argument is
+// the expression on the left side of the operator.
+type (
+	prefixParseFn func() ast.Expression
+	infixParseFn  func(ast.Expression) ast.Expression
 )
 
 // Parser represents the parser with fields to manage the current and next tokens,
 // as well as a reference to the lexer that provides the tokens.
 type Parser struct {
-	l         *lexer.Lexer // l is a pointer to an instance of the lexer, used to get the next token.
-	curToken  token.Token  // curToken is the current token under examination.
-	peekToken token.Token  // peekToken is the next token, used to help decide what to do after curToken.
-	errors    []string     // A slice of strings to store any errors encountered during parsing.
+	l         *lexer.Lexer             // l is a pointer to an instance of the lexer, used to get the next token.
+	curToken  token.Token              // curToken is the current token under examination.
+	peekToken token.Token              // peekToken is the next token, used to help decide what to do after curToken.
+	errors    []*diagnostic.Diagnostic // The errors encountered during parsing, in the order they were found.
+	panicking bool                     // Set after an error until the parser has resynchronized at a statement boundary.
+	lexErrors int                      // How many of the lexer's errors have been copied into errors.
+	comments  []token.Comment          // Every comment read so far, in source order.
+
+	prefixParseFns map[token.TokenType]prefixParseFn // Parsing functions for tokens in prefix position.
+	infixParseFns  map[token.TokenType]infixParseFn  // Parsing functions for tokens in infix position.
 }
 
 // New creates and returns a new instance of Parser.
@@ -21,8 +78,48 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{}, // Initialize the errors slice as an empty list.
+		errors: []*diagnostic.Diagnostic{}, // Initialize the errors slice as an empty list.
 	}
+
+	// Register the parsing functions for every token that can start an expression.
+	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	p.registerPrefix(token.IDENT, p.parseIdentifier)
+	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+
+	// Register the parsing functions for every operator that can appear between two expressions.
+	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	p.registerInfix(token.PLUS, p.parseInfixExpression)
+	p.registerInfix(token.MINUS, p.parseInfixExpression)
+	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.EQ, p.parseInfixExpression)
+	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.LT, p.parseInfixExpression)
+	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	// Read two tokens so that curToken and peekToken are both set before parsing begins.
 	p.nextToken()
 	p.nextToken()
@@ -30,29 +127,61 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 // Errors returns the list of errors that the parser encountered during parsing.
-func (p *Parser) Errors() []string {
+// Every error is a Diagnostic, which carries the span, a stable code and the tokens involved
+// besides the message, so callers can render it with diagnostic.Fprint or inspect it directly.
+func (p *Parser) Errors() []*diagnostic.Diagnostic {
 	return p.errors
 }
 
-// peekError adds an error message to the parser's errors slice when the expected
-// token type does not match the actual peekToken type.
+// addError records an error diagnostic pointing at tok and puts the parser into panic mode.
+// While panicking, further errors are dropped: they are almost always a consequence of the first one.
+func (p *Parser) addError(tok token.Token, code string, expected []token.TokenType, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+
+	p.errors = append(p.errors, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     diagnostic.Span{Start: tok.Pos, End: tok.End},
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Expected: expected,
+		Found:    tok,
+	})
+}
+
+// peekError records an error when the expected token type does not match the actual peekToken type.
 func (p *Parser) peekError(t token.TokenType) {
-	// Create an error message indicating the expected token type and the actual token type.
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
+	// The lexer has already explained what's wrong with an ILLEGAL token, so just start recovering.
+	if p.peekTokenIs(token.ILLEGAL) {
+		p.panicking = true
+		return
+	}
 
-	// Append the error message to the errors slice.
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, diagnostic.UnexpectedToken, []token.TokenType{t},
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // nextToken is a helper method that advances the parser's current and next tokens.
 // It moves peekToken to curToken and fetches the next token from the lexer to update peekToken.
+// Errors found by the lexer are copied into the parser's errors as soon as they show up.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// Tokens arrive in source order, so collecting their trivia keeps the comments sorted.
+	p.comments = append(p.comments, p.peekToken.Leading...)
+	p.comments = append(p.comments, p.peekToken.Trailing...)
+
+	if lexErrors := p.l.Errors(); len(lexErrors) > p.lexErrors {
+		p.errors = append(p.errors, lexErrors[p.lexErrors:]...)
+		p.lexErrors = len(lexErrors)
+	}
 }
 
 // ParseProgram is the entry point for parsing a Monkey program.
-// For now, it's not implemented and simply returns nil.
+// It parses statements until EOF and returns the root node of the AST.
 func (p *Parser) ParseProgram() *ast.Program {
 	// Create the root node of the AST, which will hold all the statements.
 	program := &ast.Program{}
@@ -75,23 +204,91 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	// The EOF token has been read, so these are all the comments in the file.
+	program.Comments = p.comments
+
 	// Return the fully constructed AST root node.
 	return program
 }
 
+// parseStatement parses one statement. If that fails, it recovers by skipping to the next
+// statement boundary and returns a BadStatement in place of the broken one.
 func (p *Parser) parseStatement() ast.Statement {
-	// parseStatement checks the type of the current token to decide what kind of statement to parse.
-	// If the current token is a 'LET' token, it delegates to parseLetStatement.
+	start := p.curToken
+
+	stmt := p.parseStatementByType()
+
+	if p.panicking {
+		p.synchronize()
+		p.panicking = false
+		return &ast.BadStatement{Token: start, To: p.curToken}
+	}
+
+	return stmt
+}
+
+// parseStatementByType checks the type of the current token to decide what kind of statement to parse.
+// 'let' and 'return' start their own statements; anything else must be an expression statement.
+func (p *Parser) parseStatementByType() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	default:
-		return nil // If the token type is not recognized, return nil.
+		return p.parseExpressionStatement()
+	}
+}
+
+// synchronize skips tokens until the end of the broken statement: a semicolon, or the token
+// before a closing brace, a keyword that starts a new statement, or EOF.
+// Braces opened by the skipped tokens are tracked, so a block of the broken statement,
+// like the body of 'if (x { 1 }', is skipped up to its matching closing brace
+// instead of ending the statement in the middle of the block.
+// Like every statement parser it leaves curToken on the last token that belongs to the statement,
+// so the caller's nextToken moves to the start of the next one.
+func (p *Parser) synchronize() {
+	depth := 0
+
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth = max(depth-1, 0)
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		if p.peekTokenIs(token.EOF) {
+			return
+		}
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.RETURN:
+				return
+			}
+		}
+		p.nextToken()
 	}
 }
 
+// parseExpressionStatement parses a statement that consists of a single expression, e.g. 'x + 10;'.
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	// The semicolon is optional, which makes expressions like '5 + 5' in the REPL easier to type.
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// Create a new ReturnStatement node with the current token (which should be 'return').
 	stmt := &ast.ReturnStatement{Token: p.curToken}
@@ -99,9 +296,10 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// Move to the next token in preparation for parsing the expression that follows the 'return' keyword.
 	p.nextToken()
 
-	// TODO: Currently, we are skipping over the expression until we find a semicolon.
-	// In the future, this will be replaced with actual expression parsing.
-	for !p.curTokenIs(token.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	// The semicolon is optional, so only skip it when it's there.
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -128,9 +326,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// TODO: Currently, we're skipping the expressions that follow the '=' sign
-	// until we encounter a semicolon. This will be replaced with actual expression parsing later.
-	for !p.curTokenIs(token.SEMICOLON) {
+	// Move past the '=' and parse the expression that provides the value.
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	// The semicolon is optional, so only skip it when it's there.
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -160,3 +362,395 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		return false // Return false if the expected token type does not match.
 	}
 }
+
+// registerPrefix adds a prefix parsing function for the given token type.
+func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+// registerInfix adds an infix parsing function for the given token type.
+func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
+}
+
+// noPrefixParseFnError records an error when a token that can't start an expression is found.
+func (p *Parser) noPrefixParseFnError(t token.TokenType) {
+	// The lexer has already explained what's wrong with an ILLEGAL token, so just start recovering.
+	if t == token.ILLEGAL {
+		p.panicking = true
+		return
+	}
+
+	p.addError(p.curToken, diagnostic.MissingExpression, nil, "no prefix parse function for %s found", t)
+}
+
+// Precedence returns how tightly the infix operator t binds, or LOWEST if t isn't an infix operator.
+// Calls and index expressions count as operators, binding with CALL and INDEX.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// peekPrecedence returns the precedence of the next token, or LOWEST if it isn't an operator.
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
+// curPrecedence returns the precedence of the current token, or LOWEST if it isn't an operator.
+func (p *Parser) curPrecedence() int {
+	return Precedence(p.curToken.Type)
+}
+
+// parseExpression is the heart of the Pratt parser.
+// It parses the expression starting at curToken with the prefix function of that token, then keeps
+// handing the result to infix functions for as long as the next operator binds tighter than precedence.
+func (p *Parser) parseExpression(precedence int) ast.Expression {
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if prefix == nil {
+		p.noPrefixParseFnError(p.curToken.Type)
+		return &ast.BadExpression{Token: p.curToken}
+	}
+	leftExp := prefix()
+
+	// Stop at a semicolon or as soon as the next operator binds less tightly than the one we're in.
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+
+		p.nextToken()
+
+		leftExp = infix(leftExp)
+	}
+
+	return leftExp
+}
+
+// parseIdentifier turns the current IDENT token into an Identifier node.
+func (p *Parser) parseIdentifier() ast.Expression {
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseIntegerLiteral converts the current INT token into an IntegerLiteral node.
+// Integer literals are always decimal, so a leading zero doesn't make them octal:
+// 010 is ten. The lexer only produces digits, so the only way to fail is overflow.
+func (p *Parser) parseIntegerLiteral() ast.Expression {
+	lit := &ast.IntegerLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	if err != nil {
+		p.addError(p.curToken, diagnostic.InvalidIntegerLit, nil, "could not parse %q as integer", p.curToken.Literal)
+		return &ast.BadExpression{Token: p.curToken}
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// parseStringLiteral turns the current STRING token into a StringLiteral node.
+// The lexer has already resolved the escape sequences, so the literal is the value.
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parsePrefixExpression parses an operator in prefix position together with the operand that follows it.
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	// Move past the operator and parse the operand with the PREFIX precedence,
+	// so that '-a * b' is parsed as '((-a) * b)'.
+	p.nextToken()
+	expression.Right = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+// parseInfixExpression parses an operator in infix position. The left operand has already been parsed
+// and is passed in; the right operand is parsed with the operator's own precedence,
+// which makes operators of the same precedence left-associative.
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+// parseBoolean turns the current TRUE or FALSE token into a Boolean node.
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// parseGroupedExpression parses an expression wrapped in parentheses.
+// Parsing the inner expression with LOWEST precedence is all it takes to make '(5 + 5) * 2' group correctly.
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseIfExpression parses 'if (<condition>) { ... }' with an optional 'else { ... }'.
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	// The else branch is optional.
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseBlockStatement parses statements until the closing '}' (or EOF) is reached.
+// curToken must be the opening '{' when it's called and is left on the closing '}'.
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	block.Rbrace = p.curToken
+	return block
+}
+
+// parseFunctionLiteral parses 'fn(<parameters>) { ... }'.
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseMacroLiteral parses 'macro(<parameters>) { ... }', which is written like a function literal.
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseFunctionParameters parses the comma separated list of identifiers between '(' and ')'.
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	// An empty parameter list: 'fn() { ... }'.
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// parseCallExpression parses the argument list of a call. The expression producing
+// the function has already been parsed and is passed in as function.
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken
+	return exp
+}
+
+// parseExpressionList parses a comma separated list of expressions up to the end token,
+// e.g. the arguments of a call or the elements of an array. curToken must be the opening token
+// when it's called and is left on the end token.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	// An empty list: 'add()' or '[]'.
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+// parseArrayLiteral parses '[<expression>, <expression>, ...]'.
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken
+	return array
+}
+
+// parseIndexExpression parses the part between the brackets of 'left[index]' or of a slice
+// 'left[low:high]', where either bound may be left out. The expression being indexed has already
+// been parsed and is passed in as left.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	bracket := p.curToken
+
+	// A slice without a lower bound: 'left[:high]' or 'left[:]'.
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(bracket, left, nil)
+	}
+
+	p.nextToken()
+	index := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(bracket, left, index)
+	}
+
+	exp := &ast.IndexExpression{Token: bracket, Left: left, Index: index}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// parseSliceExpression parses the optional upper bound and the closing bracket of a slice.
+// curToken must be the ':' when it's called.
+func (p *Parser) parseSliceExpression(bracket token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: bracket, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// parseHashLiteral parses '{<key>: <value>, ...}'.
+// A '{' only reaches this function when it starts an expression: the parsers of if expressions
+// and function literals call parseBlockStatement for their bodies themselves, so a brace there
+// is always a block and a brace anywhere else is always a hash.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
+
+	return hash
+}
@@ -1,12 +1,53 @@
 package parser
 
 import (
+	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
+	"interpreter/token"
 	"testing"
 )
 
 func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = 10;", "y", 10},
+		{"let foobar = y;", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program == nil {
+			t.Fatalf("ParseProgram() returned nil")
+		}
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestLetStatementErrors(t *testing.T) {
 	input := `
    let x 5;
    let = 10;
@@ -14,33 +55,891 @@ func TestLetStatements(t *testing.T) {
    `
 	l := lexer.New(input)
 	p := New(l)
+	p.ParseProgram()
+
+	expected := []string{
+		"2:10: expected next token to be =, got INT instead",
+		"3:8: expected next token to be IDENT, got = instead",
+		"4:8: expected next token to be IDENT, got INT instead",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("parser has %d errors, want %d: %q", len(errors), len(expected), errors)
+	}
 
+	for i, msg := range expected {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let a = 1;
+let b 2;
+let c = fn(x) {
+  let = x;
+  return x
+};
+add(1 2);
+let d = (3 + ;
+let e = 5;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"2:7: expected next token to be =, got INT instead",
+		"4:7: expected next token to be IDENT, got = instead",
+		"7:7: expected next token to be ), got INT instead",
+		"8:14: no prefix parse function for ; found",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("parser has %d errors, want %d: %q", len(errors), len(expectedErrors), errors)
+	}
+	for i, msg := range expectedErrors {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+
+	expectedStatements := []string{
+		"let a = 1;",
+		"<bad statement>",
+		"let c = fn(x) <bad statement>return x;;",
+		"<bad statement>",
+		"<bad statement>",
+		"let e = 5;",
+	}
+
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d (%q)",
+			len(expectedStatements), len(program.Statements), program.String())
+	}
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf("statements[%d] wrong. expected=%q, got=%q", i, expected, program.Statements[i].String())
+		}
+	}
+
+	bad := program.Statements[1].(*ast.BadStatement)
+	if got := input[bad.Pos().Offset:bad.End().Offset]; got != "let b 2;" {
+		t.Errorf("bad statement span wrong. expected=%q, got=%q", "let b 2;", got)
+	}
+}
+
+func TestErrorRecoverySkipsBlocks(t *testing.T) {
+	input := `if (x { 1 }
+let y = fn() { if (y { let z = 1; return z } };
+let w = 2;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"1:7: expected next token to be ), got { instead",
+		"2:22: expected next token to be ), got { instead",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("parser has %d errors, want %d: %q", len(errors), len(expectedErrors), errors)
+	}
+	for i, msg := range expectedErrors {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+
+	expectedStatements := []string{"<bad statement>", "let y = fn() <bad statement>;", "let w = 2;"}
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d (%q)",
+			len(expectedStatements), len(program.Statements), program.String())
+	}
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf("statements[%d] wrong. expected=%q, got=%q", i, expected, program.Statements[i].String())
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return 10;", 10},
+		{"return foobar;", "foobar"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+		if returnStmt.TokenLiteral() != "return" {
+			t.Fatalf("returnStmt.TokenLiteral not 'return', got %q", returnStmt.TokenLiteral())
+		}
+		if !testLiteralExpression(t, returnStmt.ReturnValue, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestParsingPrefixExpressions(t *testing.T) {
+	prefixTests := []struct {
+		input    string
+		operator string
+		value    interface{}
+	}{
+		{"let x = !5;", "!", 5},
+		{"let x = -15;", "-", 15},
+		{"let x = !foobar;", "!", "foobar"},
+		{"let x = ~5;", "~", 5},
+		{"let x = -foobar;", "-", "foobar"},
+	}
+
+	for _, tt := range prefixTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		exp, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.PrefixExpression)
+		if !ok {
+			t.Fatalf("value is not ast.PrefixExpression. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+		}
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+		if !testLiteralExpression(t, exp.Right, tt.value) {
+			return
+		}
+	}
+}
+
+func TestParsingInfixExpressions(t *testing.T) {
+	infixTests := []struct {
+		input      string
+		leftValue  interface{}
+		operator   string
+		rightValue interface{}
+	}{
+		{"let x = 5 + 5;", 5, "+", 5},
+		{"let x = 5 - 5;", 5, "-", 5},
+		{"let x = 5 * 5;", 5, "*", 5},
+		{"let x = 5 / 5;", 5, "/", 5},
+		{"let x = 5 > 5;", 5, ">", 5},
+		{"let x = 5 < 5;", 5, "<", 5},
+		{"let x = 5 == 5;", 5, "==", 5},
+		{"let x = 5 != 5;", 5, "!=", 5},
+		{"let x = 5 <= 5;", 5, "<=", 5},
+		{"let x = 5 >= 5;", 5, ">=", 5},
+		{"let x = 5 % 5;", 5, "%", 5},
+		{"let x = 5 & 5;", 5, "&", 5},
+		{"let x = 5 | 5;", 5, "|", 5},
+		{"let x = 5 ^ 5;", 5, "^", 5},
+		{"let x = 5 << 5;", 5, "<<", 5},
+		{"let x = 5 >> 5;", 5, ">>", 5},
+		{"let x = a && b;", "a", "&&", "b"},
+		{"let x = a || b;", "a", "||", "b"},
+		{"let x = foobar + barfoo;", "foobar", "+", "barfoo"},
+	}
+
+	for _, tt := range infixTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		val := program.Statements[0].(*ast.LetStatement).Value
+		if !testInfixExpression(t, val, tt.leftValue, tt.operator, tt.rightValue) {
+			return
+		}
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = -a * b;", "let x = ((-a) * b);"},
+		{"let x = !-a;", "let x = (!(-a));"},
+		{"let x = a + b + c;", "let x = ((a + b) + c);"},
+		{"let x = a + b - c;", "let x = ((a + b) - c);"},
+		{"let x = a * b * c;", "let x = ((a * b) * c);"},
+		{"let x = a * b / c;", "let x = ((a * b) / c);"},
+		{"let x = a + b / c;", "let x = (a + (b / c));"},
+		{"let x = a + b * c + d / e - f;", "let x = (((a + (b * c)) + (d / e)) - f);"},
+		{"let x = 5 > 4 == 3 < 4;", "let x = ((5 > 4) == (3 < 4));"},
+		{"let x = 5 < 4 != 3 > 4;", "let x = ((5 < 4) != (3 > 4));"},
+		{"let x = 3 + 4 * 5 == 3 * 1 + 4 * 5;", "let x = ((3 + (4 * 5)) == ((3 * 1) + (4 * 5)));"},
+		{"return 1 + 2 * 3;", "return (1 + (2 * 3));"},
+		{"true", "true"},
+		{"3 > 5 == false", "((3 > 5) == false)"},
+		{"!(true == true)", "(!(true == true))"},
+		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
+		{"(5 + 5) * 2", "((5 + 5) * 2)"},
+		{"2 / (5 + 5)", "(2 / (5 + 5))"},
+		{"-(5 + 5)", "(-(5 + 5))"},
+		{"a + add(b * c) + d", "((a + add((b * c))) + d)"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))"},
+		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a | b & c", "(a | (b & c))"},
+		{"a ^ b | c", "((a ^ b) | c)"},
+		{"a & 1 == 0", "((a & 1) == 0)"},
+		{"1 << a + b", "((1 << a) + b)"},
+		{"~a & b", "((~a) & b)"},
+		{"-a >> 2 < 3 || !b", "((((-a) >> 2) < 3) || (!b))"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[1:2]", "(-(a[1:2]))"},
+		{"f(x)[1][:2]", "((f(x)[1])[:2])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestExpressionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"foobar;", "foobar"},
+		{"5;", 5},
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		if !testLiteralExpression(t, stmt.Expression, tt.expected) {
+			return
+		}
+	}
+}
+
+func TestIntegerLiteralsAreDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"010;", 10},
+		{"09;", 9},
+		{"0;", 0},
+		{"9223372036854775807;", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		integ, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if integ.Value != tt.expected {
+			t.Errorf("wrong value for %q. want=%d, got=%d", tt.input, tt.expected, integ.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralOverflow(t *testing.T) {
+	p := New(lexer.New("9223372036854775808;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("parser has %d errors, want 1: %q", len(errors), errors)
+	}
+	if errors[0].Code != diagnostic.InvalidIntegerLit {
+		t.Errorf("wrong code. expected=%s, got=%s", diagnostic.InvalidIntegerLit, errors[0].Code)
+	}
+	if errors[0].Error() != `1:1: could not parse "9223372036854775808" as integer` {
+		t.Errorf("wrong error: %q", errors[0].Error())
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello \"world\"\n";`
+
+	l := lexer.New(input)
+	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
 	}
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	if literal.Value != "hello \"world\"\n" {
+		t.Errorf("literal.Value not %q. got=%q", "hello \"world\"\n", literal.Value)
+	}
+	if literal.String() != `"hello \"world\"\n"` {
+		t.Errorf("literal.String() not %q. got=%q", `"hello \"world\"\n"`, literal.String())
 	}
+}
+
+func TestLexicalErrorsAreReported(t *testing.T) {
+	input := `let a = "abc\q";
+let b = 1 @ 2;
+let c = "ok";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"1:13: unknown escape sequence \\q",
+		"2:11: illegal character '@'",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("parser has %d errors, want %d: %q", len(errors), len(expected), errors)
+	}
+	for i, msg := range expected {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+
+	if _, ok := program.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf("statements[0] is not *ast.BadStatement. got=%T", program.Statements[0])
+	}
+	last := program.Statements[len(program.Statements)-1]
+	if last.String() != `let c = "ok";` {
+		t.Errorf("last statement wrong. got=%q", last.String())
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
 
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	if array.End().Offset != len(input) {
+		t.Errorf("array.End() wrong. expected offset %d, got=%d", len(input), array.End().Offset)
+	}
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	array, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", program.Statements[0])
+	}
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	// The expected bounds are given as their String(), or "" when the bound is left out.
 	tests := []struct {
-		expectedIdentifier string
+		input string
+		low   string
+		high  string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"arr[1:3]", "1", "3"},
+		{"arr[:2]", "", "2"},
+		{"arr[1:]", "1", ""},
+		{"arr[:]", "", ""},
+		{"arr[-2:n + 1]", "(-2)", "(n + 1)"},
 	}
 
-	for i, tt := range tests {
-		stmt := program.Statements[i]
-		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, slice.Left, "arr") {
 			return
 		}
+
+		if low := boundString(slice.Low); low != tt.low {
+			t.Errorf("slice.Low wrong for %q. expected=%q, got=%q", tt.input, tt.low, low)
+		}
+		if high := boundString(slice.High); high != tt.high {
+			t.Errorf("slice.High wrong for %q. expected=%q, got=%q", tt.input, tt.high, high)
+		}
 	}
+}
 
+func boundString(exp ast.Expression) string {
+	if exp == nil {
+		return ""
+	}
+	return exp.String()
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+		if literal.Value != expected[i].key {
+			t.Errorf("pairs[%d] key wrong. expected=%q, got=%q", i, expected[i].key, literal.Value)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	l := lexer.New("{}")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", program.Statements[0])
+	}
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 0 + 1, 2: 10 - 8, true: 15 / 5}`, `{"one": (0 + 1), 2: (10 - 8), true: (15 / 5)}`},
+		{`let h = {"a": {"b": [1]}}; h["a"]["b"]`, `let h = {"a": {"b": [1]}};((h["a"])["b"])`},
+		{`if (x) { {} } else { {"k": fn(x) { x }} }`, `ifx {}else {"k": fn(x) x}`},
+		{`{"a": 1,}`, `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statement. got=%d", len(exp.Consequence.Statements))
+	}
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+	}
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	consequence := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative is not 1 statement. got=%+v", exp.Alternative)
+	}
+	alternative := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	function, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", program.Statements[0])
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statement. got=%d", len(function.Body.Statements))
+	}
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statement. got=%d", len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	if macro.End().Offset != len(input) {
+		t.Errorf("macro.End() wrong. want offset %d, got=%d", len(input), macro.End().Offset)
+	}
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, -2);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	fn := letStmt.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node          ast.Node
+		expectedPos   string
+		expectedEnd   string
+		expectedBytes string
+	}{
+		{program, "1:1", "4:11", input[:len(input)-1]},
+		{letStmt, "1:1", "3:2", "let add = fn(x, y) {\n  x + y;\n}"},
+		{letStmt.Name, "1:5", "1:8", "add"},
+		{fn, "1:11", "3:2", "fn(x, y) {\n  x + y;\n}"},
+		{fn.Body, "1:20", "3:2", "{\n  x + y;\n}"},
+		{body, "2:3", "2:8", "x + y"},
+		{call, "4:1", "4:11", "add(1, -2)"},
+		{call.Arguments[1], "4:8", "4:10", "-2"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedPos {
+			t.Errorf("tests[%d] - Pos wrong. expected=%s, got=%s", i, tt.expectedPos, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - End wrong. expected=%s, got=%s", i, tt.expectedEnd, tt.node.End())
+		}
+		if got := input[tt.node.Pos().Offset:tt.node.End().Offset]; got != tt.expectedBytes {
+			t.Errorf("tests[%d] - span wrong. expected=%q, got=%q", i, tt.expectedBytes, got)
+		}
+	}
+}
+
+func TestErrorDiagnostics(t *testing.T) {
+	input := "let x 5;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("parser has no errors")
+	}
+
+	d := errors[0]
+	if d.Severity != diagnostic.Error {
+		t.Errorf("d.Severity wrong. expected=%s, got=%s", diagnostic.Error, d.Severity)
+	}
+	if d.Code != diagnostic.UnexpectedToken {
+		t.Errorf("d.Code wrong. expected=%s, got=%s", diagnostic.UnexpectedToken, d.Code)
+	}
+	if d.Span.Start.String() != "1:7" || d.Span.End.String() != "1:8" {
+		t.Errorf("d.Span wrong. expected=1:7-1:8, got=%s-%s", d.Span.Start, d.Span.End)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN {
+		t.Errorf("d.Expected wrong. expected=[%s], got=%v", token.ASSIGN, d.Expected)
+	}
+	if d.Found.Type != token.INT || d.Found.Literal != "5" {
+		t.Errorf("d.Found wrong. got=%+v", d.Found)
+	}
+}
+
+func TestProgramComments(t *testing.T) {
+	input := `// first
+let x = 1; /* second */
+fn(a /* third */) { a } // fourth
+/* fifth */`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{"// first", "/* second */", "/* third */", "// fourth", "/* fifth */"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(program.Comments))
+	}
+	for i, text := range expected {
+		if program.Comments[i].Text != text {
+			t.Errorf("comments[%d] wrong. want=%q, got=%q", i, text, program.Comments[i].Text)
+		}
+	}
 }
 
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
@@ -65,6 +964,91 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	return true
 }
 
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integ, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
+		t.Errorf("integ.TokenLiteral not %d. got=%s", value, integ.TokenLiteral())
+		return false
+	}
+	return true
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
+		return false
+	}
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %s. got=%s", value, ident.TokenLiteral())
+		return false
+	}
+	return true
+}
+
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+	if bo.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("bo.TokenLiteral not %t. got=%s", value, bo.TokenLiteral())
+		return false
+	}
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+	return true
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 
@@ -74,8 +1058,8 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser has %d errors", len(errors))
 
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, d := range errors {
+		t.Errorf("parser error: %q", d.Error())
 	}
 
 	t.FailNow()
@@ -0,0 +1,438 @@
+// Package printer renders syntax trees back to Monkey source code in its canonical form:
+// two-space indentation, one statement per line, single spaces around infix operators and
+// after commas, and only the parentheses the precedence of the operators requires, besides
+// those around bitwise and shift operations that are mixed with arithmetic or comparisons.
+//
+// Comments are taken from ast.Program.Comments, so they are only printed when a whole program
+// is printed. Comments between statements keep their place; comments inside an expression
+// are moved to the end of its statement, since an expression is always printed on one line.
+package printer
+
+import (
+	"interpreter/ast"
+	"interpreter/parser"
+	"interpreter/token"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// indentation is written once per nesting level at the start of every line.
+const indentation = "  "
+
+// primary is the precedence of expressions that never need parentheses, e.g. literals.
+const primary = parser.INDEX + 1
+
+// Fprint writes the canonical source code of node to w.
+// A program ends with a newline; any other node is printed without one.
+func Fprint(w io.Writer, node ast.Node) error {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+		p.statementList(node.Statements, token.Position{Offset: math.MaxInt})
+	case ast.Statement:
+		p.statement(node)
+	case ast.Expression:
+		p.expression(node, parser.LOWEST)
+	}
+
+	_, err := io.WriteString(w, p.out.String())
+	return err
+}
+
+// String returns the canonical source code of node.
+func String(node ast.Node) string {
+	var out strings.Builder
+	Fprint(&out, node)
+	return out.String()
+}
+
+// printer holds the state of a single Fprint call.
+type printer struct {
+	out         strings.Builder
+	indent      int  // The current nesting level.
+	atLineStart bool // Whether the indentation of the current line still has to be written.
+
+	comments []token.Comment // The comments of the program, in source order.
+	next     int             // The index of the first comment that hasn't been printed.
+
+	// line is the source line the last printed statement or comment ended on, used to keep
+	// blank lines between statements. It is 0 when nothing has been printed at this level yet.
+	line int
+}
+
+// write writes s, indenting it first if it starts a line.
+func (p *printer) write(s string) {
+	if p.atLineStart {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.atLineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+// linebreak ends the current line.
+func (p *printer) linebreak() {
+	p.out.WriteString("\n")
+	p.atLineStart = true
+}
+
+// blankLine writes an empty line if the source had one or more between the last printed
+// statement or comment and the one starting on line. Runs of blank lines are collapsed into one.
+func (p *printer) blankLine(line int) {
+	if p.line != 0 && line > p.line+1 {
+		p.out.WriteString("\n")
+	}
+}
+
+// statementList prints statements one per line, together with the comments before them.
+// end is the position of the '}' closing the list, and comments before it are printed
+// after the last statement.
+func (p *printer) statementList(statements []ast.Statement, end token.Position) {
+	for i, stmt := range statements {
+		// Comments on the line of this statement belong to it unless they come after the next one.
+		limit := end
+		if i+1 < len(statements) {
+			limit = statements[i+1].Pos()
+		}
+
+		p.leadingComments(stmt.Pos())
+		p.blankLine(stmt.Pos().Line)
+		p.statement(stmt)
+		if i+1 < len(statements) && p.needsSemicolon(stmt, statements[i+1]) {
+			p.write(";")
+		}
+		p.trailingComments(stmt.End(), limit)
+		p.linebreak()
+	}
+
+	p.leadingComments(end)
+}
+
+// statement prints a statement without its line break. Let and return statements always end
+// with a semicolon, expression statements unless they end with a block; needsSemicolon decides
+// whether the block needs one anyway.
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		p.expression(stmt.Name, parser.LOWEST)
+		p.write(" = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+		if !endsWithBlock(stmt.Expression) {
+			p.write(";")
+		}
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+
+	default:
+		p.write(stmt.String())
+	}
+}
+
+// endsWithBlock reports whether the source of e ends with a '}' closing a block.
+func endsWithBlock(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IfExpression, *ast.FunctionLiteral, *ast.MacroLiteral:
+		return true
+	}
+	return false
+}
+
+// needsSemicolon reports whether stmt ends with a block and has to be separated from next by
+// a semicolon anyway, because next starts with a token that would otherwise continue stmt:
+// in 'if (x) { a } -1' the parser reads the '-' as a subtraction, and '(' and '[' would make
+// a call and an index expression.
+func (p *printer) needsSemicolon(stmt, next ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok || !endsWithBlock(es.Expression) {
+		return false
+	}
+	ns, ok := next.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	// Follow the left operands down to the expression that's printed first.
+	e := ns.Expression
+	for {
+		var left ast.Expression
+		var min int
+
+		switch n := e.(type) {
+		case *ast.InfixExpression:
+			left, min = n.Left, parser.Precedence(n.Token.Type)
+		case *ast.CallExpression:
+			left, min = n.Function, parser.CALL
+		case *ast.IndexExpression:
+			left, min = n.Left, parser.CALL
+		case *ast.SliceExpression:
+			left, min = n.Left, parser.CALL
+		case *ast.PrefixExpression:
+			return n.Operator == "-"
+		case *ast.ArrayLiteral:
+			return true
+		default:
+			return false
+		}
+
+		// A parenthesized operand starts with '(', which would make a call.
+		if precedence(left) < min {
+			return true
+		}
+		e = left
+	}
+}
+
+// block prints a block statement, with its statements indented on lines of their own.
+// An empty block without comments is printed as '{}'.
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !p.commentBefore(block.Rbrace.Pos) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.linebreak()
+
+	outerLine := p.line
+	p.line = 0
+	p.indent++
+	p.statementList(block.Statements, block.Rbrace.Pos)
+	p.indent--
+	p.line = outerLine
+
+	p.write("}")
+}
+
+// precedence returns how tightly e binds, for deciding whether it needs parentheses.
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		// Calls, indexes and slices chain from left to right, so they all count as one level.
+		return parser.CALL
+	}
+	return primary
+}
+
+// operandPrecedence returns the precedence operand of infix needs to be printed without
+// parentheses, which is min unless the operand mixes bitwise or shift operators with arithmetic
+// or comparisons. Those bind differently than in C, so e.g. 'a & 1 == 0' would be misleading,
+// and such operands are always printed in parentheses: '(a & 1) == 0'.
+func operandPrecedence(infix *ast.InfixExpression, operand ast.Expression, min int) int {
+	inner, ok := operand.(*ast.InfixExpression)
+	if !ok {
+		return min
+	}
+	if isBitwise(infix.Token.Type) && isArithmetic(inner.Token.Type) ||
+		isArithmetic(infix.Token.Type) && isBitwise(inner.Token.Type) {
+		return primary
+	}
+	return min
+}
+
+// isBitwise reports whether t is a bitwise or shift operator.
+func isBitwise(t token.TokenType) bool {
+	switch t {
+	case token.AMPERSAND, token.PIPE, token.CARET, token.SHL, token.SHR:
+		return true
+	}
+	return false
+}
+
+// isArithmetic reports whether t is an arithmetic or comparison operator.
+func isArithmetic(t token.TokenType) bool {
+	switch t {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.PERCENT,
+		token.EQ, token.NOT_EQ, token.LT, token.GT, token.LT_EQ, token.GT_EQ:
+		return true
+	}
+	return false
+}
+
+// expression prints e, in parentheses if it binds less tightly than min.
+func (p *printer) expression(e ast.Expression, min int) {
+	if e == nil {
+		return
+	}
+	if precedence(e) < min {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+
+	case *ast.IntegerLiteral:
+		// Nodes built by hand may not have a token, so fall back to the value.
+		if e.Token.Literal != "" {
+			p.write(e.Token.Literal)
+		} else {
+			p.write(strconv.FormatInt(e.Value, 10))
+		}
+
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(e.Value))
+
+	case *ast.StringLiteral:
+		p.write(e.String())
+
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		p.expression(e.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		// The operators are left-associative, so only the right operand needs parentheses
+		// when it binds exactly as tightly as the operator.
+		prec := parser.Precedence(e.Token.Type)
+		p.expression(e.Left, operandPrecedence(e, e.Left, prec))
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, operandPrecedence(e, e.Right, prec+1))
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(param, parser.LOWEST)
+		}
+		p.write(") ")
+		p.block(e.Body)
+
+	case *ast.MacroLiteral:
+		p.write("macro(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(param, parser.LOWEST)
+		}
+		p.write(") ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.write("(")
+		p.expressionList(e.Arguments)
+		p.write(")")
+
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(e.Elements)
+		p.write("]")
+
+	case *ast.IndexExpression:
+		p.expression(e.Left, parser.CALL)
+		p.write("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.write("]")
+
+	case *ast.SliceExpression:
+		p.expression(e.Left, parser.CALL)
+		p.write("[")
+		p.expression(e.Low, parser.LOWEST)
+		p.write(":")
+		p.expression(e.High, parser.LOWEST)
+		p.write("]")
+
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.write(": ")
+			p.expression(pair.Value, parser.LOWEST)
+		}
+		p.write("}")
+
+	default:
+		p.write(e.String())
+	}
+}
+
+// expressionList prints expressions separated by commas.
+func (p *printer) expressionList(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, parser.LOWEST)
+	}
+}
+
+// commentBefore reports whether a comment that hasn't been printed yet ends before pos.
+func (p *printer) commentBefore(pos token.Position) bool {
+	return p.next < len(p.comments) && p.comments[p.next].End.Offset <= pos.Offset
+}
+
+// leadingComments prints the comments before pos on lines of their own.
+func (p *printer) leadingComments(pos token.Position) {
+	for p.commentBefore(pos) {
+		c := p.comments[p.next]
+		p.next++
+
+		p.blankLine(c.Pos.Line)
+		p.write(c.Text)
+		p.linebreak()
+		p.line = c.End.Line
+	}
+}
+
+// trailingComments prints the comments that belong at the end of a statement ending at end:
+// the ones inside it that haven't been printed yet, and the ones after it on the same line
+// that come before limit. Only the last of them may be a line comment, so a line comment
+// followed by more comments makes the rest continue on the next line.
+func (p *printer) trailingComments(end, limit token.Position) {
+	p.line = end.Line
+
+	afterLineComment := false
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		inside := c.Pos.Offset < end.Offset
+		sameLine := c.Pos.Line == end.Line && c.Pos.Offset < limit.Offset
+		if !inside && !sameLine {
+			break
+		}
+		p.next++
+
+		if afterLineComment {
+			p.linebreak()
+		} else {
+			p.write(" ")
+		}
+		p.write(c.Text)
+
+		afterLineComment = strings.HasPrefix(c.Text, "//")
+		p.line = max(p.line, c.End.Line)
+	}
+}
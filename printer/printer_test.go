@@ -0,0 +1,198 @@
+package printer
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// testFormat checks that input is printed as expected, and that printing the result again
+// doesn't change it.
+func testFormat(t *testing.T, input, expected string) {
+	t.Helper()
+
+	program := parse(t, input)
+	actual := String(program)
+	if actual != expected {
+		t.Errorf("wrong output for %q.\nwant:\n%s\ngot:\n%s", input, expected, actual)
+		return
+	}
+
+	if again := String(parse(t, actual)); again != actual {
+		t.Errorf("output of %q changes when it's formatted again.\nfirst:\n%s\nsecond:\n%s", input, actual, again)
+	}
+
+	// The debugging form of the tree shows the grouping, so it must not change either.
+	if reparsed := parse(t, actual).String(); reparsed != program.String() {
+		t.Errorf("output of %q parses differently: %q instead of %q", input, reparsed, program.String())
+	}
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=5", "let x = 5;\n"},
+		{"return x ;", "return x;\n"},
+		{"x; y\nz;", "x;\ny;\nz;\n"},
+		{`let s = "a\tb\u{1}";`, "let s = \"a\\tb\\u{1}\";\n"},
+		{"let t = true == !false;", "let t = true == !false;\n"},
+		{"[1,2 , 3][ 1 : ]; a[:2]; a[:]", "[1, 2, 3][1:];\na[:2];\na[:];\n"},
+		{`{"a":1, true : [ ]}; {}`, "{\"a\": 1, true: []};\n{};\n"},
+		{"add( 1 ,2 )(3)", "add(1, 2)(3);\n"},
+		{
+			"let f = fn(x,y){ x+y };",
+			"let f = fn(x, y) {\n  x + y;\n};\n",
+		},
+		{
+			"if (x) { let y = x; y } else { }",
+			"if (x) {\n  let y = x;\n  y;\n} else {}\n",
+		},
+		{
+			"let m = macro(a,b) { quote(unquote(a)+unquote(b)) };",
+			"let m = macro(a, b) {\n  quote(unquote(a) + unquote(b));\n};\n",
+		},
+		{
+			"fn() { fn() { if (a) { return b } } }",
+			"fn() {\n  fn() {\n    if (a) {\n      return b;\n    }\n  }\n}\n",
+		},
+		{
+			"let even = fn(n) { n&1==0 }; let mask = (a<<1)+1;",
+			"let even = fn(n) {\n  (n & 1) == 0;\n};\nlet mask = (a << 1) + 1;\n",
+		},
+		// A block at the end of a statement only needs a semicolon when the next statement
+		// would otherwise continue it.
+		{
+			"if (a) { b }; -c; if (a) { b }; [c][0]; if (a) { b }; (c + d) * e; if (a) { b } !c; if (a) { b }; (c)(d);",
+			"if (a) {\n  b;\n};\n-c;\nif (a) {\n  b;\n};\n[c][0];\nif (a) {\n  b;\n};\n(c + d) * e;\nif (a) {\n  b;\n}\n!c;\nif (a) {\n  b;\n}\nc(d);\n",
+		},
+		// Blank lines between statements are kept, but runs of them are collapsed.
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;\n\n",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"let f = fn() {\n\n  a;\n\n  b;\n\n};",
+			"let f = fn() {\n  a;\n\n  b;\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		testFormat(t, tt.input, tt.expected)
+	}
+}
+
+func TestParentheses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"((1 + 2)) * 3", "(1 + 2) * 3"},
+		{"1 + (2 * 3)", "1 + 2 * 3"},
+		{"(1 - 2) - 3", "1 - 2 - 3"},
+		{"1 - (2 - 3)", "1 - (2 - 3)"},
+		{"1 - (2 + 3)", "1 - (2 + 3)"},
+		{"(a || b) && c", "(a || b) && c"},
+		{"a || (b && c)", "a || b && c"},
+		{"(a < b) == (c > d)", "a < b == c > d"},
+		{"(1 << 2) + 3", "(1 << 2) + 3"},
+		{"1 << 2 + 3", "(1 << 2) + 3"},
+		{"1 << (2 + 3)", "1 << (2 + 3)"},
+		{"(a << 1) + 1", "(a << 1) + 1"},
+		{"(a & 1) == 0", "(a & 1) == 0"},
+		{"a & 1 == 0", "(a & 1) == 0"},
+		{"0 != (a & b)", "0 != (a & b)"},
+		{"(a * 2) & m", "(a * 2) & m"},
+		{"(a + b) | c", "(a + b) | c"},
+		{"a | b + c", "(a | b) + c"},
+		{"-a << 1", "-a << 1"},
+		{"(1 | 2) & 3", "(1 | 2) & 3"},
+		{"(a & b) | (c << 1)", "a & b | c << 1"},
+		{"(a & 1) && b", "a & 1 && b"},
+		{"(a * 2) + 1", "a * 2 + 1"},
+		{"-(a + b)", "-(a + b)"},
+		{"-(-a)", "--a"},
+		{"!(-a)", "!-a"},
+		{"(-a) * b", "-a * b"},
+		{"(-a)[0]", "(-a)[0]"},
+		{"-(a[0])", "-a[0]"},
+		{"(f(x))[0]", "f(x)[0]"},
+		{"(a[0])(1)", "a[0](1)"},
+		{"(a + b)(c)", "(a + b)(c)"},
+		{"(a + b)[1:2]", "(a + b)[1:2]"},
+		{"f((a + b), [(c)])", "f(a + b, [c])"},
+		{"(fn(x) { x })(1)", "fn(x) {\n  x;\n}(1)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		expression := program.Statements[0].(*ast.ExpressionStatement).Expression
+
+		actual := String(expression)
+		if actual != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+
+		if reparsed := parse(t, actual).String(); reparsed != program.String() {
+			t.Errorf("output of %q parses differently: %q instead of %q", tt.input, reparsed, program.String())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only a comment", "// only a comment\n"},
+		{
+			"// The answer.\nlet x = 42;   // trailing\n/* block */ let y = x;",
+			"// The answer.\nlet x = 42; // trailing\n/* block */\nlet y = x;\n",
+		},
+		{
+			"let a = 1;\n\n// Second.\n\nlet b = 2;\n// The end.\n",
+			"let a = 1;\n\n// Second.\n\nlet b = 2;\n// The end.\n",
+		},
+		// Comments on the line of a statement belong to the statement they follow.
+		{"a; /* a */ b; // b", "a; /* a */\nb; // b\n"},
+		// Comments inside an expression move to the end of the statement.
+		{
+			"puts(1, /* two */ 2, // three\n 3);\nnext;",
+			"puts(1, 2, 3); /* two */ // three\nnext;\n",
+		},
+		{
+			"f(a, // a\n b, // b\n c);",
+			"f(a, b, c); // a\n// b\n",
+		},
+		{
+			"let f = fn(x) { // Doubles x.\n  // Multiply.\n  x * 2 // here\n  // Done.\n};",
+			"let f = fn(x) {\n  // Doubles x.\n  // Multiply.\n  x * 2; // here\n  // Done.\n};\n",
+		},
+		{
+			"if (a) { /* nothing */ } else {}",
+			"if (a) {\n  /* nothing */\n} else {}\n",
+		},
+		{
+			"/* a\n   b */\nx;",
+			"/* a\n   b */\nx;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		testFormat(t, tt.input, tt.expected)
+	}
+}
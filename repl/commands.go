@@ -0,0 +1,137 @@
+package repl
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/token"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// command is a meta-command of the REPL, typed as ':<name> <argument>'.
+type command struct {
+	name    string
+	arg     string // The argument, for the usage message; empty if the command takes none.
+	summary string
+	run     func(s *session, arg string)
+}
+
+// commands lists the meta-commands in the order :help shows them.
+// It's filled in by init, since the help command refers back to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"tokens", "<input>", "print the tokens of the input", (*session).tokensCommand},
+		{"ast", "<input>", "print the syntax tree of the input", (*session).astCommand},
+		{"env", "", "list the bindings of the session", (*session).envCommand},
+		{"load", "<file>", "evaluate a file in the session", (*session).loadCommand},
+		{"reset", "", "forget all bindings and macros", (*session).resetCommand},
+		{"time", "<input>", "evaluate the input and report how long it took", (*session).timeCommand},
+		{"help", "", "show this message", (*session).helpCommand},
+	}
+}
+
+// runCommand runs the meta-command line, which starts with a colon.
+// The argument is everything after the command name, and may span several lines.
+func (s *session) runCommand(line string) {
+	name, arg := line[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if (cmd.arg == "") != (arg == "") {
+			fmt.Fprintf(s.out, "usage: %s\n", cmd.usage())
+			return
+		}
+		cmd.run(s, arg)
+		return
+	}
+
+	fmt.Fprintf(s.out, "unknown command :%s, :help lists the commands\n", name)
+}
+
+// usage returns how the command is typed, e.g. ":load <file>".
+func (cmd *command) usage() string {
+	if cmd.arg == "" {
+		return ":" + cmd.name
+	}
+	return ":" + cmd.name + " " + cmd.arg
+}
+
+// tokensCommand prints the tokens of input in the format of 'monkey tokens', followed by the lexical errors.
+func (s *session) tokensCommand(input string) {
+	l := lexer.New(input)
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(s.out, "%-8s %-9s %q\n", tok.Pos, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	diagnostic.FprintAll(s.out, "", input, l.Errors())
+}
+
+// astCommand prints the syntax tree of input with ast.Fprint, without expanding its macros.
+func (s *session) astCommand(input string) {
+	p := parser.New(lexer.New(input))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, "", input, p.Errors())
+		return
+	}
+	ast.Fprint(s.out, program)
+}
+
+// envCommand prints every binding of the session as '<name> = <value>', sorted by name,
+// followed by the macros.
+func (s *session) envCommand(string) {
+	for _, env := range []*object.Environment{s.env, s.macroEnv} {
+		for _, name := range env.Names() {
+			value, _ := env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+	}
+}
+
+// loadCommand evaluates the file at path in the session, as if it had been typed in.
+func (s *session) loadCommand(path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+	s.run(path, string(src))
+}
+
+// resetCommand replaces the environments of the session with empty ones.
+func (s *session) resetCommand(string) {
+	s.env = object.NewEnvironment()
+	s.macroEnv = object.NewEnvironment()
+}
+
+// timeCommand evaluates input and prints how long the evaluation took, not counting parsing
+// and macro expansion.
+func (s *session) timeCommand(input string) {
+	if elapsed, ok := s.run("", input); ok {
+		fmt.Fprintf(s.out, "time: %s\n", elapsed)
+	}
+}
+
+// helpCommand lists the meta-commands.
+func (s *session) helpCommand(string) {
+	for _, cmd := range commands {
+		fmt.Fprintf(s.out, "  %-16s %s\n", cmd.usage(), cmd.summary)
+	}
+}
@@ -0,0 +1,615 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HISTORY_FILE is the file in the home directory where the lines typed into the REPL are kept.
+const HISTORY_FILE = ".monkey_history"
+
+// MAX_HISTORY is the number of lines kept in the history.
+const MAX_HISTORY = 1000
+
+// errInterrupted is returned by readLine when the user gives up the line with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the input of the REPL one line at a time. It returns io.EOF at the end of the input.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// scanReader reads lines with a bufio.Scanner, for input that isn't a terminal.
+type scanReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// readLine writes prompt and reads the next line.
+func (r *scanReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// newLineReader returns the line editor if both in and out are a terminal,
+// and a plain scanReader otherwise. words lists what a word can be completed to.
+func newLineReader(in io.Reader, out io.Writer, words func() []string) lineReader {
+	inFile, inOk := in.(*os.File)
+	outFile, outOk := out.(*os.File)
+	if !inOk || !outOk || !isTerminal(int(inFile.Fd())) || !isTerminal(int(outFile.Fd())) {
+		return &scanReader{scanner: bufio.NewScanner(in), out: out}
+	}
+
+	e := &editor{
+		in:    bufio.NewReader(inFile),
+		out:   out,
+		raw:   func() (func() error, error) { return makeRaw(int(inFile.Fd())) },
+		words: words,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		e.loadHistory(filepath.Join(home, HISTORY_FILE))
+	}
+	return e
+}
+
+// key is a key the user pressed: a rune, which includes control characters like ctrlA,
+// or one of the negative constants for keys that terminals send as escape sequences.
+type key rune
+
+// Keys that don't stand for a character.
+const (
+	keyUp key = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown // An escape sequence that isn't supported.
+)
+
+// Control characters, as sent by the keys pressed together with Ctrl.
+const (
+	ctrlA     key = 1
+	ctrlB     key = 2
+	ctrlC     key = 3
+	ctrlD     key = 4
+	ctrlE     key = 5
+	ctrlF     key = 6
+	ctrlG     key = 7
+	ctrlH     key = 8
+	tab       key = 9
+	ctrlK     key = 11
+	ctrlL     key = 12
+	ctrlN     key = 14
+	ctrlP     key = 16
+	ctrlR     key = 18
+	ctrlU     key = 21
+	ctrlW     key = 23
+	escape    key = 27
+	backspace key = 127
+)
+
+// editor is a line editor in the style of readline for the REPL on a terminal.
+// It supports moving the cursor with the arrow keys and the usual Emacs keys,
+// browsing the history, searching it backwards with Ctrl-R and completing words with Tab.
+// The terminal is only in raw mode while a line is read, so the output of the evaluation
+// goes through the terminal as usual.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// raw switches the terminal into raw mode and returns the function that switches it back.
+	// It's nil when there is no terminal to switch, e.g. in tests.
+	raw func() (restore func() error, err error)
+
+	// words returns everything a word can be completed to. It may be nil.
+	words func() []string
+
+	history     []string // The lines read before, the oldest first.
+	historyFile string   // The file every new history line is appended to; empty to keep the history in memory.
+
+	// The line being edited.
+	prompt   string
+	buf      []rune
+	pos      int    // The position of the cursor in buf.
+	histIdx  int    // The history line shown, or len(history) for the line being typed.
+	typedBuf []rune // The line being typed, kept while browsing the history.
+}
+
+// readLine shows prompt and lets the user edit a line until Enter is pressed.
+// It returns io.EOF when Ctrl-D is pressed on an empty line and errInterrupted for Ctrl-C.
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	e.histIdx, e.typedBuf = len(e.history), nil
+	e.refresh()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		if k == ctrlR {
+			if k, err = e.search(); err != nil {
+				return "", err
+			}
+		}
+
+		switch k {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+		case ctrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.remove(e.pos, e.pos+1)
+		default:
+			e.edit(k)
+		}
+		e.refresh()
+	}
+}
+
+// readKey reads the next key, decoding the escape sequences of the arrow keys and their friends.
+func (e *editor) readKey() (key, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || key(r) != escape {
+		return key(r), err
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case '[':
+		// A control sequence: parameters, followed by a final byte from '@' to '~'.
+		var seq strings.Builder
+		for {
+			r, _, err = e.in.ReadRune()
+			if err != nil {
+				return 0, err
+			}
+			seq.WriteRune(r)
+			if r >= '@' && r <= '~' {
+				break
+			}
+		}
+		switch seq.String() {
+		case "A":
+			return keyUp, nil
+		case "B":
+			return keyDown, nil
+		case "C":
+			return keyRight, nil
+		case "D":
+			return keyLeft, nil
+		case "H", "1~", "7~":
+			return keyHome, nil
+		case "F", "4~", "8~":
+			return keyEnd, nil
+		case "3~":
+			return keyDelete, nil
+		}
+	case 'O':
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'C':
+			return keyRight, nil
+		case 'D':
+			return keyLeft, nil
+		case 'H':
+			return keyHome, nil
+		case 'F':
+			return keyEnd, nil
+		}
+	}
+
+	return keyUnknown, nil
+}
+
+// edit applies a key that changes the line or moves the cursor. Unknown keys are ignored.
+func (e *editor) edit(k key) {
+	switch k {
+	case keyLeft, ctrlB:
+		e.pos = max(e.pos-1, 0)
+	case keyRight, ctrlF:
+		e.pos = min(e.pos+1, len(e.buf))
+	case keyHome, ctrlA:
+		e.pos = 0
+	case keyEnd, ctrlE:
+		e.pos = len(e.buf)
+	case backspace, ctrlH:
+		e.remove(e.pos-1, e.pos)
+	case keyDelete:
+		e.remove(e.pos, e.pos+1)
+	case ctrlK:
+		e.remove(e.pos, len(e.buf))
+	case ctrlU:
+		e.remove(0, e.pos)
+	case ctrlW:
+		start := e.pos
+		for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		e.remove(start, e.pos)
+	case keyUp, ctrlP:
+		e.showHistory(e.histIdx - 1)
+	case keyDown, ctrlN:
+		e.showHistory(e.histIdx + 1)
+	case tab:
+		e.complete()
+	case ctrlL:
+		io.WriteString(e.out, "\x1b[H\x1b[2J")
+	default:
+		if k >= ' ' && unicode.IsPrint(rune(k)) {
+			e.insert(string(rune(k)))
+		}
+	}
+}
+
+// insert inserts s at the cursor and moves the cursor behind it.
+func (e *editor) insert(s string) {
+	runes := []rune(s)
+	e.buf = append(e.buf[:e.pos], append(runes, e.buf[e.pos:]...)...)
+	e.pos += len(runes)
+}
+
+// remove removes buf[start:end], clamped to the line, and moves the cursor to start if it was behind it.
+func (e *editor) remove(start, end int) {
+	start, end = max(start, 0), min(end, len(e.buf))
+	if start >= end {
+		return
+	}
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	if e.pos > start {
+		e.pos = max(start, e.pos-(end-start))
+	}
+}
+
+// refresh redraws the line and puts the cursor where it belongs.
+func (e *editor) refresh() {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.buf))
+	b.WriteString("\x1b[K") // Clear the rest of the old line.
+	b.WriteString("\r")
+	if column := displayWidth([]rune(e.prompt)) + displayWidth(e.buf[:e.pos]); column > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", column)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+// wideRunes are the East Asian Wide and Fullwidth characters, which take two cells on a terminal.
+var wideRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1},
+		{0x231a, 0x231b, 1},
+		{0x2329, 0x232a, 1},
+		{0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f0, 1},
+		{0x23f3, 0x23f3, 1},
+		{0x25fd, 0x25fe, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x267f, 0x267f, 1},
+		{0x2693, 0x2693, 1},
+		{0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26aa, 1},
+		{0x26ab, 0x26ab, 1},
+		{0x26bd, 0x26bd, 1},
+		{0x26be, 0x26be, 1},
+		{0x26c4, 0x26c4, 1},
+		{0x26c5, 0x26c5, 1},
+		{0x26ce, 0x26ce, 1},
+		{0x26d4, 0x26d4, 1},
+		{0x26ea, 0x26ea, 1},
+		{0x26f2, 0x26f3, 1},
+		{0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1},
+		{0x26fd, 0x26fd, 1},
+		{0x2705, 0x2705, 1},
+		{0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1},
+		{0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1},
+		{0x2753, 0x2753, 1},
+		{0x2754, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2795, 0x2795, 1},
+		{0x2796, 0x2797, 1},
+		{0x27b0, 0x27b0, 1},
+		{0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b50, 1},
+		{0x2b55, 0x2b55, 1},
+		{0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1},
+		{0x3400, 0x4dbf, 1},
+		{0x4e00, 0xa4cf, 1},
+		{0xa960, 0xa97f, 1},
+		{0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1},
+		{0xfe10, 0xfe19, 1},
+		{0xfe30, 0xfe6f, 1},
+		{0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1},
+		{0x17000, 0x18cff, 1},
+		{0x1b000, 0x1b2ff, 1},
+		{0x1f004, 0x1f004, 1},
+		{0x1f0cf, 0x1f0cf, 1},
+		{0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f191, 1},
+		{0x1f192, 0x1f19a, 1},
+		{0x1f200, 0x1f251, 1},
+		{0x1f300, 0x1f64f, 1},
+		{0x1f680, 0x1f6ff, 1},
+		{0x1f900, 0x1f9ff, 1},
+		{0x20000, 0x2fffd, 1},
+		{0x30000, 0x3fffd, 1},
+	},
+}
+
+// runeWidth returns the number of terminal cells r takes: 2 for wide characters,
+// 0 for combining marks, which are drawn over the character before them, and 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return 0
+	case unicode.Is(wideRunes, r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// displayWidth returns the number of terminal cells runes take.
+func displayWidth(runes []rune) int {
+	width := 0
+	for _, r := range runes {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// showHistory replaces the line with history line idx, or with the line being typed
+// if idx is len(history). Indices outside the history are ignored.
+func (e *editor) showHistory(idx int) {
+	if idx < 0 || idx > len(e.history) {
+		return
+	}
+	if e.histIdx == len(e.history) {
+		e.typedBuf = e.buf
+	}
+
+	e.histIdx = idx
+	if idx == len(e.history) {
+		e.buf = e.typedBuf
+	} else {
+		e.buf = []rune(e.history[idx])
+	}
+	e.pos = len(e.buf)
+}
+
+// search lets the user search the history backwards for a line containing what they type,
+// like Ctrl-R in bash. Ctrl-R again finds the next older match, and Ctrl-G or Ctrl-C gives up
+// the search and restores the line. Any other key takes the match into the line and is returned,
+// so it's handled as usual: Enter, for instance, accepts the line right away.
+// When the search is given up, search returns 0, which edit ignores.
+func (e *editor) search() (key, error) {
+	var query []rune
+	match := len(e.history)
+	failed := false
+
+	for {
+		prefix := "reverse-i-search"
+		if failed {
+			prefix = "failing " + prefix
+		}
+		line := ""
+		if match < len(e.history) {
+			line = e.history[match]
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", prefix, string(query), line)
+
+		k, err := e.readKey()
+		if err != nil {
+			return 0, err
+		}
+
+		from := match
+		switch {
+		case k == ctrlR:
+			from = match - 1
+		case k == backspace || k == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			from = len(e.history) - 1
+		case k == ctrlG || k == ctrlC:
+			return 0, nil
+		case k >= ' ' && unicode.IsPrint(rune(k)):
+			query = append(query, rune(k))
+			from = min(match, len(e.history)-1)
+		default:
+			if match < len(e.history) {
+				e.buf = []rune(e.history[match])
+				e.pos = len(e.buf)
+				e.histIdx = match
+			}
+			return k, nil
+		}
+
+		found := e.findInHistory(string(query), from)
+		failed = found < 0
+		if !failed {
+			match = found
+		}
+	}
+}
+
+// findInHistory returns the index of the newest history line at or before from that contains query, or -1.
+func (e *editor) findInHistory(query string, from int) int {
+	for i := from; i >= 0; i-- {
+		if strings.Contains(e.history[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// complete completes the word before the cursor. A single candidate is inserted completely,
+// several candidates as far as they agree, and if that adds nothing they're listed below the line.
+// A word at the start of the line includes its colon, so meta-commands are completed, too.
+func (e *editor) complete() {
+	start := e.pos
+	for start > 0 && isWordRune(e.buf[start-1]) {
+		start--
+	}
+	if start == 1 && e.buf[0] == ':' {
+		start = 0
+	}
+
+	prefix := string(e.buf[start:e.pos])
+	if prefix == "" || e.words == nil {
+		return
+	}
+
+	candidates := completions(prefix, e.words())
+	switch {
+	case len(candidates) == 0:
+		io.WriteString(e.out, "\a")
+	case len(candidates) == 1:
+		e.insert(candidates[0][len(prefix):])
+	default:
+		if common := commonPrefix(candidates); len(common) > len(prefix) {
+			e.insert(common[len(prefix):])
+			return
+		}
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+// isWordRune reports whether r can be part of a word that's completed, like in an identifier.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// completions returns the words starting with prefix, sorted and without duplicates.
+func completions(prefix string, words []string) []string {
+	candidates := []string{}
+	seen := map[string]bool{}
+
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) && !seen[w] {
+			seen[w] = true
+			candidates = append(candidates, w)
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+// commonPrefix returns the longest prefix all words share.
+func commonPrefix(words []string) string {
+	common := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, common) {
+			// Drop a whole character, so a multi-byte one isn't cut in half.
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	return common
+}
+
+// addHistory appends line to the history, unless it's blank or repeats the last line,
+// and to the history file, if there is one. A history file that can't be written
+// just doesn't keep the line: the REPL works without it.
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > MAX_HISTORY {
+		e.history = e.history[len(e.history)-MAX_HISTORY:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the history from path, which new lines are appended to from now on.
+// A file with more than MAX_HISTORY lines is cut down to the newest ones.
+func (e *editor) loadHistory(path string) {
+	e.historyFile = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	if len(lines) > MAX_HISTORY {
+		lines = lines[len(lines)-MAX_HISTORY:]
+		os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	}
+	e.history = lines
+}
@@ -0,0 +1,257 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Escape sequences of the keys the editor supports.
+const (
+	up     = "\x1b[A"
+	down   = "\x1b[B"
+	right  = "\x1b[C"
+	left   = "\x1b[D"
+	home   = "\x1b[H"
+	end    = "\x1bOF"
+	delKey = "\x1b[3~"
+)
+
+// newTestEditor returns an editor that reads the keys in input and writes to out.
+func newTestEditor(input string, out io.Writer, history ...string) *editor {
+	return &editor{
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     out,
+		history: history,
+		words:   func() []string { return []string{"let", "len", "last", "puts", ":load", ":env", "xé1", "xè2"} },
+	}
+}
+
+// readLines reads lines from e until the input ends.
+func readLines(t *testing.T, e *editor) []string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := e.readLine(PROMPT)
+		if err == io.EOF {
+			return lines
+		}
+		if err != nil {
+			t.Fatalf("readLine failed: %s", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditorEditing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 3\x7f2\r", "1 + 2"},
+		{"1 + 2" + left + left + left + "*\r", "1 *+ 2"},
+		{"+ 2" + home + "1 " + end + " + 3\r", "1 + 2 + 3"},
+		{"ab" + left + left + right + "x\r", "axb"},
+		{"abc\x01\x06\x02\x02\x05d\r", "abcd"},
+		{"abc" + home + delKey + "\x04\r", "c"},
+		{"let x = 1;" + left + left + "\x0b;\r", "let x = ;"},
+		{"let x = 1;" + left + "\x15\r", ";"},
+		{"let x = 1;\x17\x17\r", "let x "},
+		{"\x1b[5~a\x1bxb\r", "ab"},
+		{"grüße\r", "grüße"},
+	}
+
+	for _, tt := range tests {
+		lines := readLines(t, newTestEditor(tt.input, io.Discard))
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("wrong line for %q. want=%q, got=%q", tt.input, tt.expected, lines)
+		}
+	}
+}
+
+func TestEditorCursorColumn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // The end of the last redraw, which puts the cursor in its column.
+	}{
+		{"ab" + left, "\r\x1b[4C"},
+		{"漢字" + left, "\r\x1b[5C"},
+		{"漢字x" + left, "\r\x1b[7C"},
+		{"ｆｕｌｌ" + left + left, "\r\x1b[7C"},
+		{"e\u0301x" + left, "\r\x1b[4C"},
+		{"ab" + home, "\r\x1b[3C"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if _, err := newTestEditor(tt.input+"\r", &out).readLine(PROMPT); err != nil {
+			t.Fatalf("readLine failed: %s", err)
+		}
+		drawn := strings.TrimSuffix(out.String(), "\r\n")
+		if !strings.HasSuffix(drawn, tt.expected) {
+			t.Errorf("wrong cursor column for %q. want suffix %q, got=%q", tt.input, tt.expected, drawn)
+		}
+	}
+}
+
+func TestEditorEndsAndInterrupts(t *testing.T) {
+	var out bytes.Buffer
+	e := newTestEditor("abc\x03def\r\x04", &out)
+
+	if _, err := e.readLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C didn't interrupt the line. got=%v", err)
+	}
+	if line, err := e.readLine(PROMPT); err != nil || line != "def" {
+		t.Errorf("wrong line after Ctrl-C. want=%q, got=%q (%v)", "def", line, err)
+	}
+	if _, err := e.readLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line didn't end the input. got=%v", err)
+	}
+	if !strings.Contains(out.String(), "^C\r\n") {
+		t.Errorf("Ctrl-C not echoed: %q", out.String())
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	input := "1\r" +
+		"1\r" + // Repeating the last line doesn't add it again.
+		"  \r" + // Neither does a blank line.
+		"2\r" +
+		"3" + up + up + "0\r" + // Browsing the history and changing the line.
+		"4" + up + down + "5\r" + // Coming back keeps the typed line.
+		up + up + up + up + up + up + "\r" + // Going beyond the oldest line stays there.
+		down + "6\r" // Going down from the typed line does nothing.
+
+	e := newTestEditor(input, io.Discard)
+	lines := readLines(t, e)
+
+	expected := []string{"1", "1", "  ", "2", "10", "45", "1", "6"}
+	if strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong lines. want=%q, got=%q", expected, lines)
+	}
+
+	expectedHistory := []string{"1", "2", "10", "45", "1", "6"}
+	if strings.Join(e.history, ",") != strings.Join(expectedHistory, ",") {
+		t.Errorf("wrong history. want=%q, got=%q", expectedHistory, e.history)
+	}
+}
+
+func TestEditorHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	e := newTestEditor("let a = 1;\rputs(a)\r", io.Discard)
+	e.loadHistory(path)
+	readLines(t, e)
+
+	e = newTestEditor(up+up+"\r", io.Discard)
+	e.loadHistory(path)
+	if lines := readLines(t, e); len(lines) != 1 || lines[0] != "let a = 1;" {
+		t.Errorf("history not kept between sessions. got=%q", lines)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "let a = 1;\nputs(a)\nlet a = 1;\n" {
+		t.Errorf("wrong history file: %q", data)
+	}
+}
+
+func TestEditorHistoryFileIsCut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	var lines strings.Builder
+	for i := 0; i < MAX_HISTORY+10; i++ {
+		lines.WriteString(strings.Repeat("x", i%7+1) + "\n")
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newTestEditor("", io.Discard)
+	e.loadHistory(path)
+	if len(e.history) != MAX_HISTORY {
+		t.Errorf("wrong history length. want=%d, got=%d", MAX_HISTORY, len(e.history))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != MAX_HISTORY {
+		t.Errorf("history file not cut. want=%d lines, got=%d", MAX_HISTORY, n)
+	}
+}
+
+func TestEditorReverseSearch(t *testing.T) {
+	history := []string{"let a = 1;", "puts(a)", "let b = 2;", "len(b)"}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\x12let\r", "let b = 2;"},
+		{"\x12let\x12\r", "let a = 1;"},
+		{"\x12let\x12\x12\r", "let a = 1;"}, // No older match: the search fails and keeps the last one.
+		{"\x12len\x7f\x7fet\r", "let b = 2;"},
+		{"\x12puts" + end + "; 1\r", "puts(a); 1"},
+		{"typed\x12puts\x07!\r", "typed!"},
+		{"\x12xyz\r", ""},
+		{"\x12nothing\r", "len(b)"}, // "n" still matches, so that line is kept.
+	}
+
+	for _, tt := range tests {
+		lines := readLines(t, newTestEditor(tt.input, io.Discard, history...))
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("wrong line for %q. want=%q, got=%q", tt.input, tt.expected, lines)
+		}
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		listed   string // The candidates listed below the line, if any.
+	}{
+		{"pu\t(1)\r", "puts(1)", ""},
+		{"l\t\r", "l", "last  len  let"},
+		{"le\tn\r", "len", "len  let"},
+		{"x = la\t\r", "x = last", ""},
+		{":lo\t x.mk\r", ":load x.mk", ""},
+		{"a:lo\t\r", "a:lo", ""},
+		{"lex\t\r", "lex", ""},
+		{"\t\r", "", ""},
+		{"x\t\r", "x", "xè2  xé1"}, // The candidates share only part of the bytes of é and è.
+		{"xé\t\r", "xé1", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		lines := readLines(t, newTestEditor(tt.input, &out))
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("wrong line for %q. want=%q, got=%q", tt.input, tt.expected, lines)
+		}
+		if tt.listed != "" && !strings.Contains(out.String(), "\r\n"+tt.listed+"\r\n") {
+			t.Errorf("candidates %q not listed for %q: %q", tt.listed, tt.input, out.String())
+		}
+	}
+}
+
+func TestSessionWords(t *testing.T) {
+	s := newSession(io.Discard)
+	s.run("", "let answer = 42; let m = macro() { quote(1) };")
+	words := strings.Join(s.words(), " ")
+
+	for _, w := range []string{"fn", "macro", "len", "puts", "answer", "m", ":load", ":help"} {
+		if !strings.Contains(" "+words+" ", " "+w+" ") {
+			t.Errorf("%q missing from the words: %s", w, words)
+		}
+	}
+}
@@ -1,35 +1,166 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
 	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
 	"interpreter/token"
 	"io"
+	"strings"
+	"time"
 )
 
 const PROMPT = ">> "
 
+// CONTINUATION_PROMPT is shown instead of PROMPT while the input read so far is incomplete.
+const CONTINUATION_PROMPT = ".. "
+
 /*
-read from the input source until encountering a newline,
-take the just read line and pass it to an instance of our lexer
-and finally print all the tokens the lexer gives us until we encounter EOF.
+read from the input source until encountering a newline, and keep reading lines
+while the input is incomplete, e.g. while a brace is still open,
+parse the just read chunk into an AST, expand its macros, evaluate it in an environment
+that lives as long as the session, and print the result.
+Macros live in an environment of their own, which also lasts for the whole session.
+A chunk starting with a colon is a meta-command, like ':env' or ':load file.mk', instead.
+Everything is written to out, so the REPL can run on any pair of streams.
+When both are a terminal, lines are read with a line editor that keeps a history
+and completes names with Tab.
 */
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	s := newSession(out)
+	lines := newLineReader(in, out, s.words)
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		chunk, ok := readChunk(lines)
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		if strings.HasPrefix(strings.TrimSpace(chunk), ":") {
+			s.runCommand(strings.TrimSpace(chunk))
+			continue
+		}
+		s.run("", chunk)
+	}
+}
+
+// session is the state that a REPL keeps between inputs.
+type session struct {
+	out      io.Writer
+	env      *object.Environment // The bindings made by the evaluated input.
+	macroEnv *object.Environment // The macros defined by the evaluated input.
+}
+
+// newSession creates a session without any bindings that writes to out.
+func newSession(out io.Writer) *session {
+	return &session{out: out, env: object.NewEnvironment(), macroEnv: object.NewEnvironment()}
+}
+
+// words returns everything a word typed into the session can be completed to:
+// the keywords, the builtins, the bindings and macros of the session and the meta-commands.
+func (s *session) words() []string {
+	words := token.Keywords()
+	for _, b := range object.Builtins {
+		words = append(words, b.Name)
+	}
+	words = append(words, s.env.Names()...)
+	words = append(words, s.macroEnv.Names()...)
+	for _, cmd := range commands {
+		words = append(words, ":"+cmd.name)
+	}
+	return words
+}
+
+// run parses src, expands its macros and evaluates it in the session, printing the result,
+// and returns how long the evaluation took. name is the file src comes from, if any;
+// it's shown with syntax errors. It returns false if src couldn't be parsed or expanded.
+func (s *session) run(name, src string) (time.Duration, bool) {
+	p := parser.New(lexer.New(src))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, name, src, p.Errors())
+		return 0, false
+	}
+
+	evaluator.DefineMacros(program, s.macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, s.macroEnv)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return 0, false
+	}
+
+	start := time.Now()
+	evaluated := evaluator.Eval(expanded, s.env)
+	elapsed := time.Since(start)
+
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+	return elapsed, true
+}
+
+// readChunk reads lines until they form a complete input, showing PROMPT before the first line
+// and CONTINUATION_PROMPT before every further one. It returns false if the input ends before
+// the first line; if it ends in the middle of a chunk, the incomplete chunk is returned,
+// so the parser can report what is missing. A line interrupted with Ctrl-C drops the chunk.
+func readChunk(lines lineReader) (string, bool) {
+	line, err := lines.readLine(PROMPT)
+	if err == errInterrupted {
+		return "", true
+	}
+	if err != nil {
+		return "", false
+	}
+
+	chunk := []string{line}
+	for !isComplete(strings.Join(chunk, "\n")) {
+		line, err := lines.readLine(CONTINUATION_PROMPT)
+		if err == errInterrupted {
+			return "", true
+		}
+		if err != nil {
+			break
+		}
+		chunk = append(chunk, line)
+	}
+
+	return strings.Join(chunk, "\n"), true
+}
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+// isComplete reports whether input can be parsed as it is, or needs more lines:
+// input is incomplete while it has more opening parentheses, braces or brackets
+// than closing ones, or ends inside a string literal or a block comment.
+// Too many closing brackets make the input complete, so the parser reports them.
+func isComplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
 		}
 	}
+
+	for _, err := range l.Errors() {
+		if err.Code == diagnostic.UnterminatedString || err.Code == diagnostic.UnterminatedComment {
+			return false
+		}
+	}
+	return depth <= 0
+}
+
+// printParserErrors reports everything the parser complained about,
+// showing the input with the offending part underlined.
+// name is the file src comes from, or empty for typed input.
+func printParserErrors(out io.Writer, name, src string, errors []*diagnostic.Diagnostic) {
+	io.WriteString(out, "Woops! The input could not be parsed:\n")
+	diagnostic.FprintAll(out, name, src, errors)
 }
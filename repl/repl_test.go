@@ -0,0 +1,178 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	input := `let a = 5;
+let add = fn(x, y) { x + y };
+add(a, 10)
+let = 1;
+1 + true
+`
+	expected := PROMPT + PROMPT + PROMPT + "15\n" +
+		PROMPT + "Woops! The input could not be parsed:\n" +
+		"error[E0001]: expected next token to be IDENT, got = instead\n" +
+		" --> 1:5\n" +
+		"  |\n" +
+		"1 | let = 1;\n" +
+		"  |     ^\n" +
+		PROMPT + "ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+		PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestStartExpandsMacros(t *testing.T) {
+	input := `let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+unless(10 > 5, "not greater", "greater")
+unless(1)
+quote(1 + unquote(2 * 3))
+`
+	expected := PROMPT + PROMPT + "greater\n" +
+		PROMPT + "ERROR: macro unless at 1:1: wrong number of arguments: want=3, got=1\n" +
+		PROMPT + "QUOTE((1 + 6))\n" +
+		PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestStartReadsMultiLineInput(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y
+};
+add(
+  1,
+  2
+)
+let s = "two
+lines"; /* a
+comment */ len(s)
+[1,
+2 +
+`
+	expected := PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT +
+		PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "3\n" +
+		PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "9\n" +
+		// The input ends before the array is closed, so the parser reports what's missing.
+		PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT +
+		"Woops! The input could not be parsed:\n" +
+		"error[E0002]: no prefix parse function for EOF found\n" +
+		" --> 2:4\n" +
+		"  |\n" +
+		"2 | 2 +\n" +
+		"  |    ^\n" +
+		PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", true},
+		{"1 + 2", true},
+		{"fn(x) {", false},
+		{"fn(x) {\n x\n}", true},
+		{"[1, [2,", false},
+		{"{\"a\": (1", false},
+		{"1)", true},
+		{"\"open", false},
+		{"\"{\"", true},
+		{"/* open", false},
+		{"// {", true},
+	}
+
+	for _, tt := range tests {
+		if actual := isComplete(tt.input); actual != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(file, []byte("let double = fn(x) { x * 2 };\nlet m = macro(x) { x };\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := ":tokens let x\n" +
+		":ast -1\n" +
+		":ast let\n" +
+		"let a = 1;\n" +
+		":load " + file + "\n" +
+		"double(a)\n" +
+		":env\n" +
+		":reset\n" +
+		":env\n" +
+		"a\n" +
+		":env 1\n" +
+		":load\n" +
+		":nope\n"
+
+	expected := PROMPT +
+		"1:1      LET       \"let\"\n" +
+		"1:5      IDENT     \"x\"\n" +
+		"1:6      EOF       \"\"\n" +
+		PROMPT +
+		"Program 1:1-1:3\n" +
+		"  Statements[0]: ExpressionStatement 1:1-1:3\n" +
+		"    Expression: PrefixExpression 1:1-1:3 -\n" +
+		"      Right: IntegerLiteral 1:2-1:3 1\n" +
+		PROMPT + "Woops! The input could not be parsed:\n" +
+		"error[E0001]: expected next token to be IDENT, got EOF instead\n" +
+		" --> 1:4\n" +
+		"  |\n" +
+		"1 | let\n" +
+		"  |    ^\n" +
+		PROMPT + PROMPT + PROMPT + "2\n" +
+		PROMPT +
+		"a = 1\n" +
+		"double = fn(x) {\n(x * 2)\n}\n" +
+		"m = macro(x) {\nx\n}\n" +
+		PROMPT + PROMPT + PROMPT + "ERROR: identifier not found: a\n" +
+		PROMPT + "usage: :env\n" +
+		PROMPT + "usage: :load <file>\n" +
+		PROMPT + "unknown command :nope, :help lists the commands\n" +
+		PROMPT
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":time 1 + 2\n:time 1 +\n"), &out)
+
+	pattern := regexp.MustCompile(`^>> 3\ntime: [0-9.]+[nµm]?s\n>> Woops! The input could not be parsed:\n(?s:.*)>> $`)
+	if !pattern.MatchString(out.String()) {
+		t.Errorf("wrong output: %q", out.String())
+	}
+}
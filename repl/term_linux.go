@@ -0,0 +1,58 @@
+//go:build linux
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getTermios reads the attributes of the terminal fd. It fails if fd isn't a terminal.
+func getTermios(fd int) (*syscall.Termios, error) {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return &t, nil
+}
+
+// setTermios changes the attributes of the terminal fd right away.
+func setTermios(fd int, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether fd is a terminal.
+func isTerminal(fd int) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// makeRaw puts the terminal fd into raw mode, like cfmakeraw(3): input is passed on byte by byte
+// without echo, line editing or signals for Ctrl-C, and output isn't translated.
+// It returns the function that restores the previous mode.
+func makeRaw(fd int) (restore func() error, err error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+	return func() error { return setTermios(fd, old) }, nil
+}
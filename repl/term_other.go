@@ -0,0 +1,16 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// isTerminal reports whether fd is a terminal. Raw mode is only implemented on Linux,
+// so elsewhere the REPL always reads plain lines.
+func isTerminal(fd int) bool {
+	return false
+}
+
+// makeRaw fails: raw mode is only implemented on Linux.
+func makeRaw(fd int) (restore func() error, err error) {
+	return nil, errors.New("raw terminal mode is only supported on Linux")
+}
@@ -1,11 +1,50 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Using a string might not lead to the same performance as using an int or a byte would.
 type TokenType string
 
+// Position describes a location in the source code.
+// Offset is counted in bytes from the start of the input, Line and Column start at 1.
+// Column counts characters (Unicode code points), not bytes, so it matches what an editor shows.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in characters, starting at 1
+}
+
+// IsValid reports whether the position has been set. The zero Position is invalid.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String renders the position as "line:column", or "-" if the position is invalid.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Comment is a '// ...' line comment or a '/* ... */' block comment.
+// Comments don't affect the meaning of a program, so instead of being tokens of their own
+// they are kept as trivia on the token they belong to.
+type Comment struct {
+	Text string   // The full text of the comment, including the // or /* */ markers.
+	Pos  Position // Position of the first character of the comment.
+	End  Position // Position immediately after the last character of the comment.
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // Position of the first character of the token.
+	End     Position // Position immediately after the last character of the token.
+
+	Leading  []Comment // Comments between the previous token and this one that aren't trailing the previous token.
+	Trailing []Comment // Comments after this token on the same line.
 }
 
 // Token types in the language.
@@ -14,8 +53,9 @@ const (
 	EOF     = "EOF"     // “end of file”, which tells our parser later on that it can stop.
 
 	// Identifiers + literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   // 1343456
+	IDENT  = "IDENT"  // add, foobar, x, y, ...
+	INT    = "INT"    // 1343456
+	STRING = "STRING" // "foo bar"
 
 	// Operators
 	ASSIGN   = "="
@@ -24,22 +64,39 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	SHL       = "<<"
+	SHR       = ">>"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -48,6 +105,7 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
 )
 
 var keywords = map[string]TokenType{
@@ -58,6 +116,7 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
 }
 
 // Checks the keywords table to see whether the given identifier is in fact a keyword.
@@ -67,3 +126,13 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords returns the keywords of the language in sorted order, e.g. for completion in the REPL.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// Frame is the call frame of a function being executed.
+type Frame struct {
+	cl          *object.Closure
+	ip          int // The position of the instruction being executed.
+	basePointer int // The stack pointer before the call; the locals start here.
+}
+
+// NewFrame creates a frame for calling cl with its locals starting at basePointer.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+// Instructions returns the bytecode of the function the frame executes.
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,871 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/object"
+)
+
+// Limits of the virtual machine. The stack starts out with StackSize slots and grows as needed,
+// like the frames do, so deep recursion and large literals work as in the evaluator.
+// Going beyond MaxStackSize or MaxFrames is a "stack overflow" runtime error.
+const (
+	StackSize    = 2048
+	MaxStackSize = 1 << 24
+	GlobalsSize  = 65536
+	MaxFrames    = 1 << 20
+)
+
+// The virtual machine has its own singletons, just like the evaluator.
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+// Error is a runtime error. Message is what the evaluator would have put into its Error object,
+// and Line is the source line of the failing instruction, or 0 if the bytecode has no line tables.
+type Error struct {
+	Message string
+	Line    int
+}
+
+// Error returns the message, without the line.
+func (e *Error) Error() string { return e.Message }
+
+// VM executes the bytecode produced by the compiler on a stack.
+// Runtime errors stop the execution and are returned by Run with the same messages
+// the evaluator puts into its Error objects.
+type VM struct {
+	constants   []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. The top of the stack is stack[sp-1].
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	// lastPopped is the value of the last top-level statement, i.e. the result of the program.
+	lastPopped object.Object
+}
+
+// New creates a virtual machine for bytecode with a fresh set of globals.
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore creates a virtual machine that shares its globals with an earlier one.
+// The REPL uses it to keep bindings around between lines.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last top-level statement that was executed,
+// which is what the evaluator would have returned for the program. It's nil if that was a let statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// StackTop returns the value on top of the stack, or nil if the stack is empty.
+func (vm *VM) StackTop() object.Object {
+	if vm.sp == 0 {
+		return nil
+	}
+	return vm.stack[vm.sp-1]
+}
+
+// currentFrame returns the frame of the function being executed.
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame enters a function call.
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+	return nil
+}
+
+// popFrame leaves a function call.
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the bytecode until the end of the program or the first runtime error,
+// which is returned as an *Error.
+func (vm *VM) Run() error {
+	if err := vm.run(); err != nil {
+		frame := vm.currentFrame()
+		return &Error{Message: err.Error(), Line: frame.cl.Fn.Lines.Line(frame.ip)}
+	}
+	return nil
+}
+
+// run is the fetch-decode-execute loop.
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			popped := vm.pop()
+			if vm.framesIndex == 1 {
+				vm.lastPopped = popped
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpLessEqual,
+			code.OpGreaterThan, code.OpGreaterEqual:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop()))); err != nil {
+				return err
+			}
+
+		case code.OpMinus, code.OpBitNot:
+			if err := vm.executePrefixOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// The loop increments ip before fetching, so stop right in front of the target.
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+			if vm.framesIndex == 1 {
+				// A let statement has no value, so a program ending in one has no result.
+				vm.lastPopped = nil
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				// The compiler hands out slots to names that are used before they're bound.
+				return fmt.Errorf("identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+			if err := vm.push(global); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			local := deref(vm.stack[frame.basePointer+int(localIndex)])
+			if local == nil {
+				// The let statement that binds the local wasn't executed, or not yet.
+				return fmt.Errorf("identifier not found: %s", variableName(frame.cl.Fn.LocalNames, int(localIndex)))
+			}
+			if err := vm.push(local); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.push(object.Builtins[builtinIndex]); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			cl := vm.currentFrame().cl
+			free := deref(cl.Free[freeIndex])
+			if free == nil {
+				// A nested function was called before the let statement that binds the variable.
+				return fmt.Errorf("identifier not found: %s", variableName(cl.Fn.FreeNames, int(freeIndex)))
+			}
+			if err := vm.push(free); err != nil {
+				return err
+			}
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			if err := vm.push(capture(&vm.stack[frame.basePointer+int(localIndex)])); err != nil {
+				return err
+			}
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.push(capture(&vm.currentFrame().cl.Free[freeIndex])); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			flags := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.executeSliceExpression(flags); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.returnFromFrame(returnValue) {
+				return nil
+			}
+
+		case code.OpReturn:
+			if vm.returnFromFrame(Null) {
+				return nil
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+
+	return nil
+}
+
+// globalName returns the name of the global at index, for error messages.
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+// variableName returns the name at index from the names of a function's locals or free variables,
+// for error messages.
+func variableName(names []string, index int) string {
+	if index < len(names) && names[index] != "" {
+		return names[index]
+	}
+	return fmt.Sprintf("variable %d", index)
+}
+
+// returnFromFrame leaves the current function and pushes value for the caller.
+// A return at the top level ends the program with value as its result, which it reports by returning true.
+func (vm *VM) returnFromFrame(value object.Object) bool {
+	if vm.framesIndex == 1 {
+		vm.lastPopped = value
+		return true
+	}
+
+	frame := vm.popFrame()
+	// Dropping the locals and the function itself in one go.
+	vm.sp = frame.basePointer - 1
+
+	// The stack has room for the value, since the function itself took up this slot.
+	vm.stack[vm.sp] = value
+	vm.sp++
+	return false
+}
+
+// push puts o on top of the stack.
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// growStack makes room for at least size slots on the stack, doubling its size to keep
+// the number of copies down.
+func (vm *VM) growStack(size int) error {
+	if size > MaxStackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	newSize := max(2*len(vm.stack), size)
+	newSize = min(newSize, MaxStackSize)
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+// pop removes the value on top of the stack and returns it.
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// executeBinaryOperation pops two operands and pushes the result of applying op to them.
+// The checks are done in the same order as in the evaluator, so the same mistakes produce the same errors.
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	var result object.Object
+	var err error
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		result, err = executeIntegerOperation(op, left.(*object.Integer), right.(*object.Integer))
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		result, err = executeStringOperation(op, left.(*object.String), right.(*object.String))
+	// Booleans and null are singletons, so comparing the pointers is enough.
+	case op == code.OpEqual:
+		result = nativeBoolToBooleanObject(left == right)
+	case op == code.OpNotEqual:
+		result = nativeBoolToBooleanObject(left != right)
+	case leftType != rightType:
+		err = fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	default:
+		err = unknownOperatorError(op, left, right)
+	}
+
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+// operators maps the binary opcodes back to the operators they were compiled from, for error messages.
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShl:          "<<",
+	code.OpShr:          ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+}
+
+// unknownOperatorError reports that op can't be applied to operands of these types.
+func unknownOperatorError(op code.Opcode, left, right object.Object) error {
+	return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+// executeIntegerOperation applies an arithmetic, bitwise or comparison opcode to two integers.
+func executeIntegerOperation(op code.Opcode, left, right *object.Integer) (object.Object, error) {
+	leftVal := left.Value
+	rightVal := right.Value
+
+	switch op {
+	case code.OpAdd:
+		return &object.Integer{Value: leftVal + rightVal}, nil
+	case code.OpSub:
+		return &object.Integer{Value: leftVal - rightVal}, nil
+	case code.OpMul:
+		return &object.Integer{Value: leftVal * rightVal}, nil
+	case code.OpDiv:
+		if rightVal == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}, nil
+	case code.OpMod:
+		if rightVal == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}, nil
+	case code.OpBitAnd:
+		return &object.Integer{Value: leftVal & rightVal}, nil
+	case code.OpBitOr:
+		return &object.Integer{Value: leftVal | rightVal}, nil
+	case code.OpBitXor:
+		return &object.Integer{Value: leftVal ^ rightVal}, nil
+	case code.OpShl:
+		if rightVal < 0 {
+			return nil, fmt.Errorf("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal << rightVal}, nil
+	case code.OpShr:
+		if rightVal < 0 {
+			return nil, fmt.Errorf("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}, nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftVal == rightVal), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftVal != rightVal), nil
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(leftVal < rightVal), nil
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(leftVal <= rightVal), nil
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(leftVal > rightVal), nil
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(leftVal >= rightVal), nil
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+// executeStringOperation concatenates two strings or compares them by value.
+func executeStringOperation(op code.Opcode, left, right *object.String) (object.Object, error) {
+	switch op {
+	case code.OpAdd:
+		return &object.String{Value: left.Value + right.Value}, nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(left.Value == right.Value), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(left.Value != right.Value), nil
+	default:
+		return nil, unknownOperatorError(op, left, right)
+	}
+}
+
+// executePrefixOperation negates an integer or flips all of its bits.
+func (vm *VM) executePrefixOperation(op code.Opcode) error {
+	operand := vm.pop()
+
+	integer, ok := operand.(*object.Integer)
+	if !ok {
+		operator := "-"
+		if op == code.OpBitNot {
+			operator = "~"
+		}
+		return fmt.Errorf("unknown operator: %s%s", operator, operand.Type())
+	}
+
+	if op == code.OpBitNot {
+		return vm.push(&object.Integer{Value: ^integer.Value})
+	}
+	return vm.push(&object.Integer{Value: -integer.Value})
+}
+
+// buildArray creates an array from the stack slots between startIndex and endIndex.
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// buildHash creates a hash from the alternating keys and values between startIndex and endIndex.
+// The pairs are added in source order, so the hash keeps that order.
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+// executeIndexExpression pushes the element of an array, character of a string or value of a hash
+// at index. Indexes outside of the array or string and missing keys produce null.
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i, ok := normalizeIndex(index.(*object.Integer).Value, len(elements))
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(elements[i])
+
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		chars := []rune(left.(*object.String).Value)
+		i, ok := normalizeIndex(index.(*object.Integer).Value, len(chars))
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(&object.String{Value: string(chars[i])})
+
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.(*object.Hash).Get(key)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(value)
+
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// normalizeIndex turns a possibly negative index into an offset into a sequence of length n
+// and reports whether it lies inside the sequence.
+func normalizeIndex(index int64, n int) (int, bool) {
+	if index < 0 {
+		index += int64(n)
+	}
+	if index < 0 || index >= int64(n) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// executeSliceExpression pops the bounds named by flags and the value being sliced,
+// and pushes a copy of the selected part of the array or string.
+func (vm *VM) executeSliceExpression(flags uint8) error {
+	var low, high object.Object
+	if flags&code.SliceHigh != 0 {
+		high = vm.pop()
+	}
+	if flags&code.SliceLow != 0 {
+		low = vm.pop()
+	}
+	left := vm.pop()
+
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len([]rune(left.Value))
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	lowIndex, err := sliceBound(low, 0, length)
+	if err != nil {
+		return err
+	}
+	highIndex, err := sliceBound(high, length, length)
+	if err != nil {
+		return err
+	}
+	if highIndex < lowIndex {
+		highIndex = lowIndex
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, highIndex-lowIndex)
+		copy(elements, left.Elements[lowIndex:highIndex])
+		return vm.push(&object.Array{Elements: elements})
+	default:
+		chars := []rune(left.(*object.String).Value)
+		return vm.push(&object.String{Value: string(chars[lowIndex:highIndex])})
+	}
+}
+
+// sliceBound turns one bound of a slice into an offset, using def when it was left out.
+// Negative bounds count from the end and bounds beyond either end are clamped.
+func sliceBound(bound object.Object, def, length int) (int, error) {
+	if bound == nil {
+		return def, nil
+	}
+
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice bound must be INTEGER, got %s", bound.Type())
+	}
+
+	value := integer.Value
+	if value < 0 {
+		value += int64(length)
+	}
+	if value < 0 {
+		value = 0
+	}
+	if value > int64(length) {
+		value = int64(length)
+	}
+
+	return int(value), nil
+}
+
+// executeCall calls the function that sits on the stack below its numArgs arguments.
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// callClosure enters cl. The arguments already on the stack become its first locals.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	// Reserve the slots for the remaining locals. They're cleared, since a cell left behind
+	// by an earlier call would otherwise take the values stored in them.
+	top := frame.basePointer + cl.Fn.NumLocals
+	if top > len(vm.stack) {
+		if err := vm.growStack(top); err != nil {
+			return err
+		}
+	}
+	clear(vm.stack[vm.sp:top])
+	vm.sp = top
+
+	return nil
+}
+
+// callBuiltin calls a Go function with the arguments on the stack and pushes its result.
+// An error returned by the builtin stops the program, as it does in the evaluator.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+	if result == nil {
+		return vm.push(Null)
+	}
+	return vm.push(result)
+}
+
+// pushClosure wraps the compiled function at constIndex in a closure that captures
+// the numFree variables on top of the stack, which OpCaptureLocal and OpCaptureFree put there as cells.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// cell holds a variable that a closure captured. The local slot or free variable it was captured
+// from holds the cell from then on, so the enclosing function and all the closures that captured
+// the variable share its value. Cells never get onto the stack other than to be captured.
+type cell struct {
+	value object.Object
+}
+
+// Type returns "CELL". It doesn't pass on the type of the value, so that a cell that ends up
+// where a value is expected, which only a crafted .mkc file can do, fails like any wrong operand.
+func (c *cell) Type() object.ObjectType { return "CELL" }
+
+// Inspect returns "cell".
+func (c *cell) Inspect() string { return "cell" }
+
+// capture returns the cell of the variable in slot, moving its value into a new cell first
+// if it hasn't been captured before.
+func capture(slot *object.Object) *cell {
+	if c, ok := (*slot).(*cell); ok {
+		return c
+	}
+	c := &cell{value: *slot}
+	*slot = c
+	return c
+}
+
+// deref returns the value of a variable that may have been captured into a cell.
+func deref(obj object.Object) object.Object {
+	if c, ok := obj.(*cell); ok {
+		return c.value
+	}
+	return obj
+}
+
+// nativeBoolToBooleanObject returns the True or False singleton.
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// isTruthy reports whether obj counts as true in a condition: only false and null are falsy.
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,501 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-10", -10},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-32 >> 2", -8},
+		{"1 + 6 & 3", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 <= 1", true},
+		{"2 >= 3", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{`"a" == "a"`, true},
+		{`"1" == 1`, false},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{"true && 1", true},
+		{"1 && 0", true},
+		{"false || false", false},
+		{"false && missing", false},
+		{"true || missing", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1;", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1 + 2, 3 * 4]", []int{3, 12}},
+		{"[]", []int{}},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][3]", Null},
+		{`"héllo"[1]`, "é"},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{`"héllo"[:2]`, "hé"},
+		{`"hello"[-3:]`, "llo"},
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, Null},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashesKeepInsertionOrder(t *testing.T) {
+	result, err := run(`{"b": 1, "a": 2, 3: 3, true: 4}`)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result.Inspect() != "{b: 1, a: 2, 3: 3, true: 4}" {
+		t.Errorf("wrong hash. got=%s", result.Inspect())
+	}
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b();", 2},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"fn(x) { x; }(5)", 5},
+		{"let globalNum = 10; let f = fn(a) { let n = 1; globalNum - a - n }; f(2) + f(3)", 13},
+		{"return 10; 9;", 10},
+		{"9; if (true) { return 2 * 5; } 9;", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{`len([1, 2, 3])`, 3},
+		{`len({"a": 1})`, 1},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`let len = fn(x) { 42 }; len("a")`, 42},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();",
+			99,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+		{
+			// Mutually recursive globals work, since g is looked up when f runs.
+			`let f = fn(n) { if (n == 0) { 0 } else { g(n - 1) } };
+			let g = fn(n) { f(n) };
+			f(3);`,
+			0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"let f = fn() { g }; f()", "identifier not found: g"},
+		{"10 / 0", "division by zero"},
+		{"5()", "not a function: INTEGER"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"len(1); 5", "argument to `len` not supported, got INTEGER"},
+		{"[1, 2][true:]", "slice bound must be INTEGER, got BOOLEAN"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{"let f = fn() { f() }; f()", "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(tt.input)
+		if err == nil {
+			t.Errorf("expected VM error for %q but got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorLines(t *testing.T) {
+	input := `let f = fn(x) {
+  x / 0
+};
+f(1);`
+
+	_, err := run(input)
+	vmErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("error is not *Error. got=%T (%+v)", err, err)
+	}
+	if vmErr.Message != "division by zero" || vmErr.Line != 2 {
+		t.Errorf("wrong error. got=%+v", vmErr)
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+	stdout := object.Stdout
+	object.Stdout = &out
+	defer func() { object.Stdout = stdout }()
+
+	result, err := run(`puts("hello", 1, [true])`)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result != Null {
+		t.Errorf("puts should return null, got=%s", result.Inspect())
+	}
+	if out.String() != "hello\n1\n[true]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+// TestMatchesEvaluator runs programs through both the evaluator and the virtual machine
+// and checks that they agree on the result or the error.
+func TestMatchesEvaluator(t *testing.T) {
+	inputs := []string{
+		"5 + 5 + 5 + 5 - 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"-17 % 5 + (1 << 4) - (-32 >> 2) + (12 & 10 | 1 ^ 3) + ~5",
+		"1 <= 2 && 2 >= 2 || 3 < 1",
+		"let f = fn() { 1 / 0 }; 1 > 2 && f()",
+		"let f = fn() { 1 / 0 }; 1 < 2 || f()",
+		"true && missing",
+		"if (1 > 2) { 10 }",
+		"if (1 < 2) { 10 } else { 20 }",
+		"9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+		"let f = fn(x) { return x; x + 10; }; f(10);",
+		"let f = fn(x) { let result = x + 10; return result; return 10; }; f(10);",
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(2);",
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		`let greet = fn(name) { "Hello" + " " + name + "!" }; greet("World")`,
+		`"a" + "b" == "ab"`,
+		"[1, 2 * 2, 3 + 3]",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][-4]",
+		`"abc"[3]`,
+		"let a = [1, 2, 3]; let n = 1; a[n:n + 1]",
+		`"hello"[4:2]`,
+		`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		`{}["foo"]`,
+		`len("")`,
+		`len("one", "two")`,
+		`first(1)`,
+		`rest([])`,
+		`push([1])`,
+		`type({})`,
+		`let map = fn(arr, f) {
+			let iter = fn(arr, accumulated) {
+				if (len(arr) == 0) { accumulated } else { iter(rest(arr), push(accumulated, f(first(arr)))) }
+			};
+			iter(arr, []);
+		};
+		map([1, 2, 3, 4], fn(x) { x * 2 });`,
+		`let reduce = fn(arr, initial, f) {
+			let iter = fn(arr, result) {
+				if (len(arr) == 0) { result } else { iter(rest(arr), f(result, first(arr))) }
+			};
+			iter(arr, initial);
+		};
+		reduce([1, 2, 3, 4, 5], 0, fn(acc, el) { acc + el });`,
+		"[1] == [1]",
+		"let a = [1]; a == a",
+		"if (true) { }",
+		"if (true) { let a = 1; }",
+		"fn() { }()",
+		"let x = 5;",
+		"1; let x 5; 2",
+		`"Hello" - "World"`,
+		`[1, 2]["a"]`,
+		"5[1:2]",
+		"1 << -1",
+		"true & false",
+		"~true",
+		// Closures capture variables by reference, so they see a later let that rebinds them.
+		"let f = fn() { let x = 1; let g = fn() { x }; let x = 5; g() }; f()",
+		"let f = fn(x) { let g = fn() { fn() { x } }; let h = g(); let x = x * 10; h() }; f(2)",
+		"let f = fn() { let x = 1; let a = fn() { x }; let b = fn() { x + 1 }; let x = 10; [a(), b()] }; f()",
+		"let f = fn(n) { let a = n; fn() { a } }; let one = f(1); let two = f(2); [one(), two()]",
+		"fn(x) { x + 1 }",
+		"let add = fn(a, b) { let sum = a + b; sum }; [add, puts]",
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(5000)",
+		// Nested functions see a let of an enclosing function that comes after them, once it's run.
+		"let f = fn() { let g = fn() { y }; let y = 1; g() }; f()",
+		"let f = fn() { let g = fn() { fn() { y } }; let h = g(); let y = 2; h() }; f()",
+		"let y = 10; let f = fn() { let g = fn() { y }; let a = y; let y = 1; a + g() }; f()",
+		"let f = fn() { let g = fn() { y }; let r = g(); let y = 1; r }; f()",
+		"let f = fn() { let g = fn() { y }; if (false) { let y = 1; }; g() }; f()",
+		"let f = fn() { if (false) { let x = 1; }; x }; f()",
+		"let sum = fn(n) { if (n == 0) { 0 } else { let rest = sum(n - 1); rest + n } }; sum(5000)",
+	}
+
+	// Large literals need more stack than the virtual machine starts out with.
+	elements := make([]string, 3000)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+	}
+	inputs = append(inputs, "["+strings.Join(elements, ", ")+"]")
+
+	for _, input := range inputs {
+		evaluated := evaluator.Eval(parse(input), object.NewEnvironment())
+		expected := "<nil>"
+		if evaluated != nil {
+			expected = evaluated.Inspect()
+		}
+
+		got := "<nil>"
+		result, err := run(input)
+		if err != nil {
+			got = "ERROR: " + err.Error()
+		} else if result != nil {
+			got = result.Inspect()
+		}
+
+		if got != expected {
+			t.Errorf("VM and evaluator disagree on %q.\nevaluator=%s\nvm       =%s", input, expected, got)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(input string) (object.Object, error) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result, err := run(tt.input)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		if err := testIntegerObject(int64(expected), actual); err != nil {
+			t.Errorf("%s: testIntegerObject failed: %s", input, err)
+		}
+
+	case bool:
+		if err := testBooleanObject(expected, actual); err != nil {
+			t.Errorf("%s: testBooleanObject failed: %s", input, err)
+		}
+
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok {
+			t.Errorf("%s: object is not String. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if str.Value != expected {
+			t.Errorf("%s: object has wrong value. got=%q, want=%q", input, str.Value, expected)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%s: object not Array: %T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("%s: wrong num of elements. want=%d, got=%d", input, len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			if err := testIntegerObject(int64(expectedElem), array.Elements[i]); err != nil {
+				t.Errorf("%s: testIntegerObject failed: %s", input, err)
+			}
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%s: object is not Null: %T (%+v)", input, actual, actual)
+		}
+
+	case nil:
+		if actual != nil {
+			t.Errorf("%s: expected no result, got %T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}